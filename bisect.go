@@ -0,0 +1,231 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bisectT isolates the entries of a bad configuration that break a command
+// that succeeds with a good configuration.
+type bisectT struct {
+	g       *config.GoConfig
+	good    *bytes.Buffer
+	bad     *config.GoConfig
+	command []string
+	tested  map[string]bool
+	steps   int
+	err     error // of the first candidate that couldn't be applied
+}
+
+// bisect runs the command after "--" with the good configuration modified by
+// subsets of the bad configuration until it finds the minimal set of changes
+// that fail.
+func (m *mainT) bisect() (err error) {
+	var command []string
+	var goodName, badName string
+	for i, s := range m.a {
+		if s == "--" {
+			command = m.a[i+1:]
+			m.a = m.a[:i]
+			break
+		}
+	}
+	if len(command) == 0 {
+		return config.NewError(config.ErrUsage,
+			"bisect: missing -- command")
+	}
+	m.a, goodName = m.a.Pop()
+	m.a, badName = m.a.Pop()
+	if goodName == "" || badName == "" {
+		return config.NewError(config.ErrUsage,
+			"bisect: need good and bad configurations")
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if m.g.IsList() {
+		return config.NewError(config.ErrUsage,
+			"bisect: can't bisect all")
+	}
+	m.g.Reinit()
+	b := &bisectT{
+		g:       m.g,
+		command: command,
+		tested:  make(map[string]bool),
+	}
+	if b.good, err = readConfiguration(goodName); err != nil {
+		return
+	}
+	b.bad = m.g.Clone()
+	if buf, err := readConfiguration(badName); err != nil {
+		return err
+	} else if err = b.bad.Load(buf); err != nil {
+		return err
+	}
+	good := m.g.Clone()
+	if err = good.Load(b.good); err != nil {
+		return
+	}
+	var diff []string
+	for _, e := range good.Entries {
+		if !e.Value.Equal(b.bad.Entry[e.Name].Value) {
+			diff = append(diff, e.Name)
+		}
+	}
+	fmt.Println("bisect:", len(diff), "differences")
+	if len(diff) == 0 {
+		return config.NewError(config.ErrUsage,
+			"bisect: configurations are the same")
+	}
+	if b.fails(nil) {
+		return config.NewError(config.ErrCommand, "bisect: %s fails",
+			goodName)
+	}
+	if !b.fails(diff) {
+		if b.err != nil {
+			return b.err
+		}
+		return config.NewError(config.ErrCommand,
+			"bisect: %s doesn't fail", badName)
+	}
+	culprits := b.ddmin(diff)
+	if b.err != nil {
+		return b.err
+	}
+	x, err := b.apply(culprits)
+	if err != nil {
+		return
+	}
+	for _, name := range culprits {
+		fmt.Printf("culprit: %s: %s -> %s\n", name,
+			good.Entry[name].Value.YAML(),
+			b.bad.Entry[name].Value.YAML())
+	}
+	if m.out == "" {
+		m.out = strings.TrimSuffix(filepath.Base(m.g.GoConfiguration),
+			".yaml") +
+			"-bisect.yaml"
+	}
+	w, err := os.Create(m.out)
+	if err != nil {
+		return
+	}
+	defer w.Close()
+	if _, err = x.WriteTo(w); err == nil {
+		fmt.Println("Wrote:", m.out)
+		err = egress
+	}
+	return
+}
+
+func readConfiguration(name string) (*bytes.Buffer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(f)
+	return buf, err
+}
+
+// apply the bad values of the named entries to the good configuration.
+func (b *bisectT) apply(names []string) (*config.GoConfig, error) {
+	x := b.g.Clone()
+	if err := x.Load(b.good); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		e, ok := x.Entry[name]
+		bad, found := b.bad.Entry[name]
+		if !ok || !found {
+			return nil, config.NewEntryError(config.ErrUnknownEntry,
+				name, "unknown entry: %s", name)
+		}
+		e.Value.Copy(bad.Value)
+		e.Record(config.OriginBisect, "")
+	}
+	return x, nil
+}
+
+// ddmin is the delta debugging minimization of the failing set of changes.
+func (b *bisectT) ddmin(c []string) []string {
+	n := 2
+	for len(c) >= 2 {
+		reduced := false
+		subsets := split(c, n)
+		for _, s := range subsets {
+			if b.fails(s) {
+				c, n, reduced = s, 2, true
+				break
+			}
+		}
+		if !reduced && n > 2 {
+			for i := range subsets {
+				var complement []string
+				for j, s := range subsets {
+					if j != i {
+						complement = append(complement, s...)
+					}
+				}
+				if b.fails(complement) {
+					c, n, reduced = complement, n-1, true
+					break
+				}
+			}
+		}
+		if !reduced {
+			if n >= len(c) {
+				break
+			}
+			if n *= 2; n > len(c) {
+				n = len(c)
+			}
+		}
+	}
+	return c
+}
+
+// fails reports whether the command fails with the named bad entries; if
+// these can't be applied, this keeps the first such error and returns false.
+func (b *bisectT) fails(names []string) bool {
+	key := strings.Join(names, " ")
+	if t, ok := b.tested[key]; ok {
+		return t
+	}
+	x, err := b.apply(names)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return false
+	}
+	b.steps += 1
+	_, err = x.Run(b.command)
+	status := "ok"
+	if err != nil {
+		status = "FAIL"
+	}
+	fmt.Printf("#%d: [%s] %s\n", b.steps, key, status)
+	b.tested[key] = err != nil
+	return err != nil
+}
+
+func split(c []string, n int) [][]string {
+	var subsets [][]string
+	for i := 0; i < n; i++ {
+		begin, end := i*len(c)/n, (i+1)*len(c)/n
+		if begin < end {
+			subsets = append(subsets, c[begin:end])
+		}
+	}
+	return subsets
+}
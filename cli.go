@@ -7,12 +7,14 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"gopkg.in/tgrennan/fixme.v0"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"io"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
 	"text/template"
@@ -20,37 +22,56 @@ import (
 )
 
 type cliT struct {
-	G       *GoConfig
+	G       *config.GoConfig
 	Name    string
 	rows    int
 	cols    int
 	row     int
-	scanner *bufio.Scanner
+	reader  lineReader
 	command map[rune]func(*cliT, int, string)
 	help    *template.Template
-	prompt  func()
+	prompt  func() string
+	search  *regexp.Regexp
+	reverse bool
+	script  *scriptReader
+	errs    int
 }
 
 const cliEntryHelpSrc = `
 goconfig commands:
-    EOF		Exit goconfig.
+    EOF		Exit goconfig; this asks to save any changes.
     ENTER	Advance to next entry.
     [N]+	Advance N (1) entries.
     [N]-	Go back N (1) entries.
+    /[regex]	Search forward for entries with matching name or help.
+    ?regex	Search backward for entries with matching name or help.
+    :n		Repeat the last search.
+    :N		Repeat the last search in the opposite direction.
+    :name	Go to the named entry.
     #		Show the configuration.
+    =[name]	Explain where '{{.Name}}' or the named entry was declared
+		and what changed its value.
     [0]^	Reinitialize '{{.Name}}' or all entries with 0 prefix.
+    [N]:u	Undo the last N (1) changes.
+    [N]:U	Redo the last N (1) undone changes.
     >		Save to {{.G.GoConfiguration}}
+    @[GOOS/GOARCH]
+		Show or change the target platform ({{.G.Platform}}).
     !<command>
     !go <command> [go flags] . [target flags]
 		Run the given command.  If the command is "go", the first
 		period ('.') argument is replaced by the package name and is
 		prepended by appropriate goconfigured build flags.
 
-Anything else sets '{{.Name}}' to the given text.  If this text is 'true',
+Anything else, including a single letter, sets '{{.Name}}' to the given
+text.  If this text is 'true',
 'false' or 'nil', then '{{.Name}}' is set to the respective value.  You may
 quote such text to force string values; for example: "true", "false", "nil".
 In addition, you may set empty strings with paired quotes (i.e. "").
 
+On a terminal, the line editor has emacs style keys, UP and DOWN history saved
+across sessions, and TAB completion of values, entry names and go commands.
+
 {{.Marshal}}
 `
 const cliPkgHelpSrc = `
@@ -59,26 +80,50 @@ goconfig commands:
     ENTER	goconfig {{.Name}}
     [N]+	Advance N (1) entries.
     [N]-	Go back N (1) entries.
+    /[regex]	Search forward for matching packages.
+    ?regex	Search backward for matching packages.
+    n		Repeat the last search.
+    N		Repeat the last search in the opposite direction.
+    :name	Go to the named package.
+    @[GOOS/GOARCH]
+		Show or change the target platform ({{.G.Platform}}).
 `
 
 var cliEntryHelp, cliPkgHelp *template.Template
 var cliErrorCommand = errors.New("unknown command")
 var cliEntryCommands = map[rune]func(*cliT, int, string){
 	0:   cliForward1,
-	'?': cliShowHelp,
+	'?': cliSearchBackward,
+	'/': cliSearch,
+	':': cliEntryJump,
 	'!': cliExec,
 	'+': cliForward,
 	'-': cliBackward,
 	'>': cliStore,
 	'#': cliShow,
 	'^': cliReinit,
+	'@': cliPlatform,
+	'=': cliExplain,
+}
+
+// cliEntryLetterCommands follow ':' so that a bare letter sets the entry.
+var cliEntryLetterCommands = map[string]func(*cliT, int, string){
+	"n": cliSearchNext,
+	"N": cliSearchPrev,
+	"u": cliUndo,
+	"U": cliRedo,
 }
 var cliPkgCommands = map[rune]func(*cliT, int, string){
 	0:   cliGoConfig,
-	'?': cliShowHelp,
+	'?': cliSearchBackward,
+	'/': cliSearch,
+	'n': cliSearchNext,
+	'N': cliSearchPrev,
+	':': cliJump,
 	'!': cliExec,
 	'+': cliForward,
 	'-': cliBackward,
+	'@': cliPlatform,
 }
 
 func init() { AddMenu("cli", __cli__) }
@@ -89,18 +134,44 @@ func __cli__(v interface{}) error {
 	cliPkgHelp = template.Must(template.New("cliPkgHelp").Parse(
 		cliPkgHelpSrc[1:]))
 	cli := new(cliT)
-	cli.G = v.(*GoConfig)
+	keepGoing := false
+	switch x := v.(type) {
+	case *Script:
+		f, err := os.Open(x.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		cli.G, keepGoing = x.G, x.KeepGoing
+		cli.script = newScriptReader(x.File, f)
+	default:
+		cli.G = v.(*config.GoConfig)
+	}
 	cli.init()
+	defer cli.reader.Close()
 	cli.title()
 	for {
 		cli.row = 0
-		cli.prompt()
-		if !cli.scanner.Scan() {
+		if cli.script != nil && cli.errs > 0 && !keepGoing {
+			return config.NewError(config.ErrCommand,
+				"%s: stopped at first error", cli.script.name)
+		}
+		t, err := cli.reader.ReadLine(cli.prompt())
+		if err == io.EOF && cli.script != nil {
+			if cli.errs > 0 {
+				return config.NewError(config.ErrCommand,
+					"%s: %d error(s)", cli.script.name,
+					cli.errs)
+			}
+			return nil
+		} else if err == io.EOF {
 			println()
-			return cli.scanner.Err()
+			cli.quit()
+			return nil
+		} else if err != nil {
+			return err
 		}
 		n := 1
-		t := cli.scanner.Text()
 		if len(t) > 0 {
 			r := rune(t[0])
 			if unicode.IsDigit(r) {
@@ -123,13 +194,15 @@ func __cli__(v interface{}) error {
 			r = rune(t[0])
 			args = strings.TrimSpace(t[1:])
 		}
-		if f, ok := cli.command[r]; ok {
+		if f, ok := cli.command[r]; ok &&
+			(!unicode.IsLetter(r) || args == "") {
 			f(cli, n, args)
 		} else if cli.G.IsList() {
 			cli.Error(cliErrorCommand)
 		} else {
-			cli.G.Set(cli.Name, strings.TrimSpace(t))
-			if s := cli.G.Entry[cli.Name].next; s != "" {
+			cli.G.Set(config.OriginUser, cli.Name,
+				strings.TrimSpace(t))
+			if s := cli.G.Entry[cli.Name].Next(); s != "" {
 				cli.Name = s
 			}
 		}
@@ -142,7 +215,7 @@ func cliBackward(cli *cliT, n int, _ string) {
 		if !ok {
 			break
 		}
-		if s := e.prev; s != "" {
+		if s := e.Prev(); s != "" {
 			cli.Name = s
 		} else {
 			break
@@ -150,10 +223,36 @@ func cliBackward(cli *cliT, n int, _ string) {
 	}
 }
 
+// cliEntryJump runs the ':' prefixed letter command or goes to the named
+// entry.
+func cliEntryJump(cli *cliT, n int, s string) {
+	if f, ok := cliEntryLetterCommands[s]; ok {
+		f(cli, n, "")
+	} else {
+		cliJump(cli, n, s)
+	}
+}
+
 func cliExec(cli *cliT, _ int, s string) {
-	b, _ := cli.G.Exec(s)
+	b, err := cli.G.Exec(s)
 	cli.row = 0
 	cli.Write(b)
+	if err != nil {
+		cli.Error(err)
+	}
+}
+
+func cliExplain(cli *cliT, _ int, s string) {
+	if s == "" {
+		s = cli.Name
+	}
+	if !cli.G.Has(s) {
+		cli.Error(config.NewEntryError(config.ErrUnknownEntry, s,
+			"unknown entry: %s", s))
+	} else {
+		cli.row = 0
+		cli.Write([]byte(cli.G.Explain(s)))
+	}
 }
 
 func cliForward(cli *cliT, n int, _ string) {
@@ -162,7 +261,7 @@ func cliForward(cli *cliT, n int, _ string) {
 		if !ok {
 			break
 		}
-		if s := e.next; s != "" {
+		if s := e.Next(); s != "" {
 			cli.Name = s
 		} else {
 			break
@@ -172,14 +271,15 @@ func cliForward(cli *cliT, n int, _ string) {
 
 func cliForward1(cli *cliT, _ int, _ string) {
 	if e, ok := cli.G.Entry[cli.Name]; ok {
-		if s := e.next; s != "" {
+		if s := e.Next(); s != "" {
 			cli.Name = s
 		}
 	}
 }
 
 func cliGoConfig(cli *cliT, _ int, _ string) {
-	if g, err := NewGoConfig(cli.Name); err == nil {
+	g, err := config.NewGoConfigFor(cli.Name, cli.G.Platform)
+	if err == nil {
 		if err = g.Load(nil); err != nil {
 			cli.Error(err)
 		}
@@ -194,17 +294,93 @@ func cliGoConfig(cli *cliT, _ int, _ string) {
 	}
 }
 
+func cliJump(cli *cliT, _ int, s string) {
+	if !cli.G.Has(s) {
+		cli.Error(config.NewEntryError(config.ErrUnknownEntry, s,
+			"unknown entry: %s", s))
+	} else {
+		cli.Name = s
+	}
+}
+
+func cliPlatform(cli *cliT, _ int, s string) {
+	if s == "" {
+		println(cli.G.Platform.String())
+	} else if p, err := config.ParsePlatform(s); err != nil {
+		cli.Error(err)
+	} else if err = cli.G.SetPlatform(p); err != nil {
+		cli.Error(err)
+	} else {
+		cli.Name = cli.G.Begin
+		cli.title()
+	}
+}
+
 func cliReinit(cli *cliT, n int, _ string) {
 	if n == 0 {
 		cli.G.Reinit()
 	} else {
-		cli.G.Entry[cli.Name].Reinit()
-		if s := cli.G.Entry[cli.Name].next; s != "" {
+		cli.G.Unset(cli.Name)
+		if s := cli.G.Entry[cli.Name].Next(); s != "" {
 			cli.Name = s
 		}
 	}
 }
 
+func cliRedo(cli *cliT, n int, _ string) {
+	for i := 0; i < n; i++ {
+		if !cli.G.Redo() {
+			println("Nothing to redo.")
+			break
+		}
+	}
+}
+
+// cliSearch finds the next entry, or with the 'N' repeat, the previous entry
+// matching the given or last pattern.
+func cliSearch(cli *cliT, _ int, s string) {
+	re, err := compileSearch(s, cli.search)
+	if err != nil {
+		cli.Error(err)
+		return
+	}
+	cli.search, cli.reverse = re, false
+	cli.find(false)
+}
+
+// cliSearchBackward is the '?' help command unless given a pattern.
+func cliSearchBackward(cli *cliT, n int, s string) {
+	if s == "" {
+		cliShowHelp(cli, n, s)
+		return
+	}
+	re, err := compileSearch(s, cli.search)
+	if err != nil {
+		cli.Error(err)
+		return
+	}
+	cli.search, cli.reverse = re, true
+	cli.find(true)
+}
+
+func cliSearchNext(cli *cliT, _ int, _ string) {
+	if cli.search == nil {
+		cli.Error(config.NewError(config.ErrUsage,
+			"no previous search pattern"))
+	} else {
+		cli.find(cli.reverse)
+	}
+}
+
+func cliSearchPrev(cli *cliT, _ int, _ string) {
+	if cli.search == nil {
+		cli.Error(config.NewError(config.ErrUsage,
+			"no previous search pattern"))
+	} else {
+		cli.find(!cli.reverse)
+	}
+}
+
 func cliShow(cli *cliT, _ int, _ string) {
 	for _, e := range cli.G.Entries {
 		print(e.Name, ": ", e.Value.YAML(), "\n")
@@ -225,27 +401,91 @@ func cliStore(cli *cliT, _ int, _ string) {
 	}
 }
 
-func (cli *cliT) entry() {
-	if e, ok := cli.G.Entry[cli.Name]; ok {
-		print(cli.Name, ": ", e.Value.YAML(), "$ ")
+func cliUndo(cli *cliT, n int, _ string) {
+	for i := 0; i < n; i++ {
+		if !cli.G.Undo() {
+			println("Nothing to undo.")
+			break
+		}
+	}
+}
+
+// complete the go subcommand of "!go", the entry name to explain or jump to,
+// or the choices or boolean values of the current entry.
+func (cli *cliT) complete(s string) (int, []string) {
+	var words []string
+	start := 0
+	switch {
+	case strings.HasPrefix(s, "!go "):
+		start = strings.LastIndex(s, " ") + 1
+		if strings.TrimSpace(s[len("!go "):start]) != "" {
+			return 0, nil
+		}
+		words = config.GoSubcommands
+	case strings.HasPrefix(s, "!"):
+		start, words = 1, []string{"go"}
+	case strings.HasPrefix(s, "="), strings.HasPrefix(s, ":"):
+		start = 1
+		for _, e := range cli.G.Entries {
+			words = append(words, e.Name)
+		}
+	case cli.G.IsList():
+		return 0, nil
+	default:
+		e, ok := cli.G.Entry[cli.Name]
+		if !ok {
+			return 0, nil
+		}
+		if e.Init.IsTag() {
+			words = []string{"true", "false"}
+		} else {
+			words = e.Choices
+		}
+	}
+	return start, withPrefix(words, s[start:])
+}
+
+func (cli *cliT) find(backward bool) {
+	if s := cli.G.Find(cli.search, cli.Name, backward); s == "" {
+		cli.Error(config.NewError(config.ErrNotFound,
+			"pattern not found: %s", cli.search))
 	} else {
-		print("$ ")
+		cli.Name = s
+	}
+}
+
+func (cli *cliT) entry() string {
+	if e, ok := cli.G.Entry[cli.Name]; ok {
+		return cli.Name + ": " + e.Value.YAML() + "$ "
 	}
+	return "$ "
 }
 
+// Error prints the error and, of scripts, counts it with its line.
 func (cli *cliT) Error(err error) {
-	println("error:", err.Error())
+	if cli.script != nil {
+		cli.errs += 1
+		println(cli.script.name+":"+strconv.Itoa(cli.script.line)+":",
+			"error:", err.Error())
+	} else {
+		println("error:", err.Error())
+	}
 }
 
 func (cli *cliT) init() {
 	cli.Name = cli.G.Begin
 	cli.resize()
-	cli.scanner = bufio.NewScanner(os.Stdin)
+	if cli.script != nil {
+		cli.reader = cli.script
+		cli.rows = 0
+	} else {
+		cli.reader = newLineReader(cli.complete)
+	}
 	if cli.G.IsList() {
 		cli.command = cliPkgCommands
 		cli.help = cliPkgHelp
-		cli.prompt = func() {
-			print(cli.Name, "$ ")
+		cli.prompt = func() string {
+			return cli.Name + "$ "
 		}
 	} else {
 		cli.command = cliEntryCommands
@@ -258,6 +498,23 @@ func (cli *cliT) Marshal() string {
 	return cli.G.Marshal(cli.Name)
 }
 
+// quit shows the pending changes, if any, and asks whether to save them; a
+// piped session has no answer and doesn't save.
+func (cli *cliT) quit() {
+	if cli.G.IsList() || !cli.G.Dirty() {
+		return
+	}
+	print(cli.G.Diff())
+	s, err := cli.reader.ReadLine("save changes? (y/N) ")
+	if err != nil {
+		println()
+		return
+	}
+	if s = strings.TrimSpace(s); s == "y" || s == "Y" {
+		cliStore(cli, 1, "")
+	}
+}
+
 func (cli *cliT) resize() {
 	cli.rows, cli.cols = 24, 80
 	i, err := strconv.Atoi(os.Getenv("LINES"))
@@ -286,20 +543,22 @@ func (cli *cliT) resize() {
 }
 
 func (cli *cliT) title() {
-	println("goconfig", cli.G.Package, "- enter ? for help.")
+	println("goconfig", cli.G.Package, cli.G.Platform.String(),
+		"- enter ? for help.")
 }
 
 // This is a primitive pager for the Help and Exec output.
 func (cli *cliT) Write(b []byte) (n int, err error) {
 	for len(b) > 0 && err == nil {
 		if cli.row == cli.rows-1 {
-			os.Stdout.Write([]byte("Press Enter to continue."))
 			cli.row = 0
-			if !cli.scanner.Scan() {
-				err = cli.scanner.Err()
+			_, err = cli.reader.ReadLine("Press Enter to continue.")
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
 				break
 			}
-			cli.scanner.Text()
 		}
 		x := 0
 		if nl := bytes.IndexByte(b, '\n'); nl >= 0 {
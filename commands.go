@@ -0,0 +1,636 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Exit codes.
+const (
+	ExitOK      = 0
+	ExitFailure = 1
+	ExitUsage   = 2
+)
+
+// commandT is a goconfig subcommand; those flagged go take the goconfigured
+// go build (and test) flags, and raw commands get their arguments unparsed.
+type commandT struct {
+	name    string
+	aliases []string
+	args    string
+	help    string
+	flags   func(*mainT, *flag.FlagSet)
+	run     func(*mainT) error
+	gotool  bool
+	raw     bool
+	hidden  bool
+}
+
+// optionalT is a flag with an optional value, -name or -name=value; without
+// a value, it's "true".
+type optionalT struct {
+	set   bool
+	value string
+}
+
+// goFlagT is a go build or test flag of the command.
+type goFlagT struct {
+	c      *config.GoCommand
+	name   string
+	isBool bool
+}
+
+var commands []*commandT
+
+func init() {
+	commands = []*commandT{
+		{
+			name: "help",
+			args: "[command]",
+			help: `
+Print the usage of goconfig or the given command.`,
+			run: (*mainT).help,
+		},
+		{
+			name: "version",
+			help: `
+Print the goconfig version.`,
+			run: (*mainT).version,
+		},
+		{
+			name: "show",
+			args: "[package]",
+			help: `
+Print the configured [or all] entries as YAML, a JSON object,
+environment variables, or make variables.  "-show" is an alias of
+this command.`,
+			flags: showFlags,
+			run:   (*mainT).show,
+		},
+		{
+			name: "declarations",
+			args: "[package]",
+			help: `
+Print the merged declarations of the package and its imports
+with the file of each.`,
+			flags: formatFlag("yaml|json"),
+			run:   (*mainT).declarations,
+		},
+		{
+			name:    "flags",
+			aliases: []string{"cmdline"},
+			args:    "[<[go] command> [go flags]] [package]",
+			help: `
+Print the goconfigured arguments that would be added to the
+given (build) command as shell words, a JSON array, or a
+GOFLAGS setting.  "cmdline" is an alias of this command.`,
+			flags: formatFlag("shell|json|goflags"),
+			run:   (*mainT).flags,
+		},
+		{
+			name: "set",
+			args: "<name=value>... [package]",
+			help: `
+Validate then set each entry, with the respective set or reset
+rules, and save the configuration.`,
+			run: (*mainT).set,
+		},
+		{
+			name: "get",
+			args: "<name> [package]",
+			help: `
+Print the value of the named entry or fail if there isn't one.`,
+			run: (*mainT).get,
+		},
+		{
+			name: "unset",
+			args: "<name> [package]",
+			help: `
+Reinitialize the named entry and save the configuration.`,
+			run: (*mainT).unset,
+		},
+		{
+			name: "explain",
+			args: "<name> [package]",
+			help: `
+Print the file and line that declared the named entry, the
+package that imported it, and each change of its value from
+init, file, -config, set or reset rules, user edits, undo or redo.`,
+			run: (*mainT).explain,
+		},
+		{
+			name: "lint",
+			args: "[package]",
+			help: `
+Print the unknown entries and invalid values of the saved, or
+-config, configuration; this fails if there are any.`,
+			run: (*mainT).lint,
+		},
+		{
+			name: "go",
+			args: "<command> [go flags] [package [args]]",
+			help: `
+Run the given go command with the configured constraints and
+strings; "go build", "go install", "go run" and "go test" are
+aliases of the respective commands.`,
+			raw: true,
+			run: (*mainT).gocommand,
+		},
+		{
+			name: "build",
+			args: "[go flags] [package]",
+			help: `
+Build the package with the configured constraints and strings.
+With -matrix, build it for each of the given targets, at most N
+(number of CPUs) at a time, with the respective declarations
+and configuration.  The output file names are generated from
+the -o template of .GOOS, .GOARCH, .Name and .Exe; the default
+is bin/GOOS_GOARCH/NAME.  With -configs, build it with each
+configuration like test.`,
+			flags:  buildFlags,
+			run:    (*mainT).gotool,
+			gotool: true,
+		},
+		{
+			name: "install",
+			args: "[go flags] [package]",
+			help: `
+Install the package with the configured constraints and strings.`,
+			run:    (*mainT).gotool,
+			gotool: true,
+		},
+		{
+			name: "run",
+			args: "[go flags] [package [args]]",
+			help: `
+Run the package with the configured constraints and strings.`,
+			run:    (*mainT).gotool,
+			gotool: true,
+		},
+		{
+			name: "test",
+			args: "[go flags] [package [args]]",
+			help: `
+Test the package with the configured constraints and strings.
+With -configs, test it with each of the given configurations,
+at most N (number of CPUs) at a time, and report those that
+fail.  Each failed configuration is saved in the package
+directory to goconfiguration_GOOS_GOARCH-<config>.yaml, as
+listed in the summary, to reproduce the failure with -config.`,
+			flags:  configsFlags,
+			run:    (*mainT).gotool,
+			gotool: true,
+		},
+		{
+			name: "allyesconfig",
+			args: "[package]",
+			help: `
+Save a configuration with every build tag set through the
+respective set and reset rules.`,
+			run: (*mainT).generate,
+		},
+		{
+			name: "allnoconfig",
+			args: "[package]",
+			help: `
+Save a configuration with every build tag reset through the
+respective set and reset rules.`,
+			run: (*mainT).generate,
+		},
+		{
+			name: "randconfig",
+			args: "[package]",
+			help: `
+Save a configuration with build tags randomly set through the
+respective set and reset rules and random choices of strings.`,
+			flags: seedFlag,
+			run:   (*mainT).generate,
+		},
+		{
+			name: "bisect",
+			args: "<good.yaml> <bad.yaml> [package] -- <command>",
+			help: `
+Find the minimal set of entries that differ from the good
+configuration to make the given command fail.  Each
+attempt applies bad values through the set and reset rules
+then runs the command, with goconfigured flags if "go".
+The culprits are printed and the minimal failing
+configuration is saved to the -o file or,
+goconfiguration_GOOS_GOARCH-bisect.yaml`,
+			flags: func(m *mainT, fs *flag.FlagSet) {
+				fs.StringVar(&m.out, "o", "", "save the minimal "+
+					"failing configuration to `file`")
+			},
+			run: (*mainT).bisect,
+		},
+		{
+			name: "serve",
+			args: "<server:port>",
+			help: `
+Run a web server at the given address; "-http=<server:port>" is
+an alias of this command.  Besides the HTML pages, this serves a
+JSON REST API of the packages and their entries at
+/goconfig/api/v1/.
+Open pages update as other sessions change, reinitialize or
+save the package.
+
+Without a host, the server only listens on the loopback
+interface; use 0.0.0.0:<port> to serve all interfaces.  With
+-token, clients must have the "Authorization: Bearer <token>"
+header or, in browsers, login with the token as the password.
+With -htpasswd, they must login as one of the file's users;
+passwords are {SHA} hashes as by "htpasswd -s"; bcrypt, MD5
+and crypt hashes aren't supported.  Browsers may only run the -go commands with
+the boolean go build and test flags, such as -race and -v.
+
+With -prefix, the pages and API are below the given path
+rather than /goconfig/.  With -tls-cert and -tls-key, the
+server is HTTPS.  An interrupt (^C) ends the server after
+current requests.`,
+			flags: webFlags,
+			run:   (*mainT).serve,
+		},
+		{
+			name: "tui",
+			args: "[package]",
+			help: `
+Run the terminal user interface.  Its colors are those of the
+GOCONFIG_THEME, one of default, dark, light or mono; NO_COLOR
+implies mono.`,
+			run: (*mainT).tui,
+		},
+		{
+			name: "keys",
+			help: `
+Print the TUI key bindings in the form of the file,
+~/.config/goconfig/keys.yaml, that maps actions to the keys
+replacing their defaults; for example,
+	forward: [DOWN, "^N", j]
+	search-prev: "N"
+Quote the single-letter keys n, N, y and Y, which YAML reads
+as booleans.`,
+			run: (*mainT).keys,
+		},
+		{
+			name: "cli",
+			args: "[package]",
+			help: `
+Run the command line interface or, with -script, the CLI
+commands of the given file, echoing each after its prompt.
+This stops with an error at the first failed command unless
+-keep-going, which reports the number of failures at the end.`,
+			flags: scriptFlags,
+			run:   (*mainT).cli,
+		},
+		{
+			name: "completion",
+			args: "<bash|zsh|fish>",
+			help: `
+Print the script for the given shell to complete commands,
+flags, packages with goconfig.yaml, and entry names and
+choices of set and get.  For example,
+	source <(goconfig completion bash)`,
+			run: (*mainT).completion,
+		},
+		{
+			name:   "__complete",
+			raw:    true,
+			hidden: true,
+			run:    (*mainT).complete,
+		},
+	}
+}
+
+// command returns the named command or nil if there isn't one.
+func command(name string) *commandT {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// exitCode returns 0 for success, 2 for usage errors and 1 otherwise.
+func exitCode(err error) int {
+	if err == nil || err == egress {
+		return ExitOK
+	}
+	if e, ok := err.(*config.Error); ok && e.Code == config.ErrUsage {
+		return ExitUsage
+	}
+	return ExitFailure
+}
+
+// parse the arguments of the named command or, if none, those of the menu.
+// Flags common to all commands may precede the command name.
+func (m *mainT) parse(args []string) (err error) {
+	menu := m.flagSet("", menuFlags)
+	i := 0
+	for ; i < len(args) && len(args[i]) > 1 && args[i][0] == '-'; i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := menu.Lookup(name); f != nil && !isBoolFlag(f) {
+			i++
+		}
+	}
+	m.cmd = nil
+	if i < len(args) {
+		m.cmd = command(args[i])
+	}
+	if m.cmd != nil && m.cmd.name == "go" && i+1 < len(args) {
+		// go build, install, run and test are aliases of the command
+		if x := command(args[i+1]); x != nil && x.gotool {
+			args = append(args[:i:i], args[i+1:]...)
+			m.cmd = x
+		}
+	}
+	if m.cmd == nil {
+		if err = m.parseFlags(menu, args); err != nil {
+			return
+		}
+		if pkg := m.a.String(0); len(m.a) > 1 {
+			// the menu flags may also follow the package
+			if err = m.parseFlags(menu, m.a[1:]); err != nil {
+				return
+			}
+			m.a = append([]string{pkg}, m.a...)
+		}
+		m.fs = menu
+	} else {
+		x := make([]string, 0, len(args)-1)
+		x = append(append(x, args[:i]...), args[i+1:]...)
+		if m.cmd.raw {
+			fs := m.flagSet(m.cmd.name, nil)
+			if err = m.parseFlags(fs, args[:i]); err != nil {
+				return
+			}
+			m.a = args[i+1:]
+		} else {
+			fs := m.flagSet(m.cmd.name, m.cmd.flags)
+			if m.cmd.gotool {
+				m.c = newGoCommand(m.cmd.name)
+				goFlags(fs, m.c)
+			}
+			if err = m.parseFlags(fs, x); err != nil {
+				return
+			}
+			if !m.cmd.gotool {
+				m.fs = fs
+			}
+		}
+	}
+	return
+}
+
+func (m *mainT) parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	switch {
+	case err == flag.ErrHelp:
+		if m.cmd == nil {
+			err = usage.Execute(os.Stdout, m.usageOptions())
+		} else {
+			err = m.commandUsage(os.Stdout, m.cmd)
+		}
+		if err == nil {
+			err = egress
+		}
+		return err
+	case err != nil:
+		const undefined = "flag provided but not defined: "
+		s := err.Error()
+		if strings.HasPrefix(s, undefined) {
+			return config.NewError(config.ErrUsage,
+				"invalid flag: %s",
+				strings.TrimPrefix(s, undefined))
+		}
+		return config.NewError(config.ErrUsage, "%s", s)
+	}
+	m.a = fs.Args()
+	return nil
+}
+
+// trailing parses the flags that follow the last argument of the command,
+// where the FlagSet stopped, and fails on any other argument.
+func (m *mainT) trailing() (err error) {
+	if m.fs == nil || len(m.a) == 0 {
+		return
+	}
+	fixmeSet, configSet := m.fixmeOpt.set, m.configOpt.set
+	if err = m.parseFlags(m.fs, m.a); err != nil {
+		return
+	}
+	if len(m.a) > 0 {
+		return config.NewError(config.ErrUsage,
+			"unexpected argument: %s", m.a[0])
+	}
+	if !fixmeSet {
+		if err = m.fixme(); err != nil {
+			return
+		}
+	}
+	if !configSet {
+		err = m.config()
+	}
+	return
+}
+
+// flagSet returns the command's flags, with those common to every command.
+func (m *mainT) flagSet(name string,
+	f func(*mainT, *flag.FlagSet)) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(&m.fixmeOpt, "fixme",
+		"print debugging messages on stderr or in the given `file`")
+	fs.Var(&m.configOpt, "config",
+		"load configuration from stdin or the given `file`")
+	fs.BoolVar(&m.json, "json", false, "print errors as JSON objects")
+	if f != nil {
+		f(m, fs)
+	}
+	return fs
+}
+
+// synopsis returns the command name and arguments.
+func (cmd *commandT) synopsis() string {
+	return strings.TrimSpace(cmd.name + " " + cmd.args)
+}
+
+// indent returns the help text with each line indented by two tabs.
+func (cmd *commandT) indent() string {
+	help := strings.TrimSpace(cmd.help)
+	return "\t\t" + strings.Replace(help, "\n", "\n\t\t", -1)
+}
+
+// commandUsage writes the synopsis, help and flags of the command.
+func (m *mainT) commandUsage(w io.Writer, cmd *commandT) error {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "Usage:\t%s %s [flags] %s\n", m.p, cmd.name,
+		cmd.args)
+	fmt.Fprintf(buf, "\n%s\n\nFlags:\n", strings.TrimSpace(cmd.help))
+	fs := m.flagSet(cmd.name, cmd.flags)
+	if cmd.gotool {
+		goFlags(fs, newGoCommand(cmd.name))
+	}
+	fs.SetOutput(buf)
+	fs.PrintDefaults()
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func menuFlags(m *mainT, fs *flag.FlagSet) {
+	fs.BoolVar(&m.helpFlag, "help", false, "print usage")
+	fs.BoolVar(&m.versionFlag, "version", false, "print the version")
+	fs.BoolVar(&m.cliFlag, "cli", false, "run the command line interface")
+	fs.StringVar(&m.http, "http", "",
+		"run a web server at the given `server:port`")
+	fs.BoolVar(&m.showFlag, "show", false, "print the configuration")
+	showFlags(m, fs)
+	scriptFlags(m, fs)
+	webFlags(m, fs)
+}
+
+func webFlags(m *mainT, fs *flag.FlagSet) {
+	fs.StringVar(&m.token, "token", "",
+		"require this bearer `token` ($GOCONFIG_TOKEN)")
+	fs.StringVar(&m.htpasswd, "htpasswd", "",
+		"require a login of the users in this `file`")
+	fs.BoolVar(&m.readOnly, "read-only", false,
+		"don't change or save configuration")
+	fs.StringVar(&m.goCommands, "go", "build,list,vet",
+		"allow browsers to run these go `commands`")
+	fs.StringVar(&m.prefix, "prefix", "",
+		"serve the pages at this `path` (/goconfig/)")
+	fs.StringVar(&m.tlsCert, "tls-cert", "",
+		"serve HTTPS with this certificate `file`")
+	fs.StringVar(&m.tlsKey, "tls-key", "",
+		"serve HTTPS with this private key `file`")
+}
+
+func showFlags(m *mainT, fs *flag.FlagSet) {
+	fs.BoolVar(&m.all, "all", false, "print all entries")
+	formatFlag("yaml|json|env|make")(m, fs)
+}
+
+func formatFlag(formats string) func(*mainT, *flag.FlagSet) {
+	return func(m *mainT, fs *flag.FlagSet) {
+		fs.StringVar(&m.format, "format", "",
+			"print as `"+formats+"`")
+	}
+}
+
+func scriptFlags(m *mainT, fs *flag.FlagSet) {
+	fs.StringVar(&m.scriptFile, "script", "",
+		"run the CLI commands of the given `file`")
+	fs.BoolVar(&m.keepGoing, "keep-going", false,
+		"run every script command despite errors")
+}
+
+func seedFlag(m *mainT, fs *flag.FlagSet) {
+	fs.StringVar(&m.seedArg, "seed", "",
+		"random number generator `seed` (current time)")
+}
+
+func configsFlags(m *mainT, fs *flag.FlagSet) {
+	fs.StringVar(&m.configsArg, "configs", "",
+		"run with each of these `allyes,allno,rand:N` configurations")
+	fs.StringVar(&m.jobs, "jobs", "",
+		"run at most `N` (number of CPUs) at a time")
+	seedFlag(m, fs)
+}
+
+func buildFlags(m *mainT, fs *flag.FlagSet) {
+	fs.StringVar(&m.matrixArg, "matrix", "",
+		"build for each of these `GOOS/GOARCH,...` targets")
+	configsFlags(m, fs)
+}
+
+// goFlags adds the go build flags, and those of test, to the command's flags.
+func goFlags(fs *flag.FlagSet, c *config.GoCommand) {
+	var names []string
+	for k := range config.GoBuildFlags {
+		names = append(names, k)
+	}
+	if c.Name == "test" {
+		for k := range config.GoTestFlags {
+			names = append(names, k)
+		}
+	}
+	for k := range config.GoBuildStringFlags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		_, isString := config.GoBuildStringFlags[k]
+		fs.Var(&goFlagT{c, k, !isString}, k, "go "+c.Name+" -"+k)
+	}
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+func newGoCommand(name string) *config.GoCommand {
+	return &config.GoCommand{
+		Name:        name,
+		Flags:       make(map[string]bool),
+		StringFlags: make(map[string]string),
+	}
+}
+
+func (o *optionalT) IsBoolFlag() bool { return true }
+
+func (o *optionalT) Set(s string) error {
+	o.set, o.value = true, s
+	return nil
+}
+
+func (o *optionalT) String() string { return o.value }
+
+func (f *goFlagT) IsBoolFlag() bool { return f.isBool }
+
+func (f *goFlagT) Set(s string) error {
+	if !f.isBool {
+		f.c.StringFlags[f.name] = s
+		return nil
+	}
+	t, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if t {
+		f.c.Flags[f.name] = t
+	} else {
+		delete(f.c.Flags, f.name)
+	}
+	return nil
+}
+
+func (f *goFlagT) String() string {
+	if f.c == nil {
+		return ""
+	}
+	return f.c.StringFlags[f.name]
+}
@@ -0,0 +1,288 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// The completion scripts pass the words of the command line, through the
+// cursor, to the hidden __complete command that prints the candidates of the
+// last, possibly empty, word.
+const bashCompletionSrc = `# bash completion of {{.}}; source this or save it in
+# /etc/bash_completion.d/{{.}}
+_{{.}}() {
+	local line="${COMP_LINE:0:COMP_POINT}"
+	local -a words
+	read -ra words <<< "$line"
+	[[ $line == *[[:space:]] ]] && words+=("")
+	local cur="${words[${#words[@]}-1]}"
+	local IFS=$'\n'
+	COMPREPLY=($({{.}} __complete "${words[@]:1}" 2>/dev/null))
+	if [[ $cur == *[=:]* ]]; then
+		local pre="${cur%"${cur##*[=:]}"}"
+		COMPREPLY=("${COMPREPLY[@]#"$pre"}")
+	fi
+}
+complete -o default -F _{{.}} {{.}}
+`
+
+const zshCompletionSrc = `#compdef {{.}}
+# zsh completion of {{.}}; save this as _{{.}} in a directory of $fpath
+_{{.}}() {
+	local -a candidates
+	candidates=("${(@f)$({{.}} __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if (( ${#candidates[@]} )) && [[ -n ${candidates[1]} ]]; then
+		compadd -Q -- "${candidates[@]}"
+	else
+		_files
+	fi
+}
+compdef _{{.}} {{.}}
+`
+
+const fishCompletionSrc = `# fish completion of {{.}}; save this as
+# ~/.config/fish/completions/{{.}}.fish
+function __{{.}}_complete
+	set -l words (commandline -opc) (commandline -ct)
+	{{.}} __complete $words[2..-1] 2>/dev/null
+end
+complete -c {{.}} -f -a '(__{{.}}_complete)'
+`
+
+var completionScripts = map[string]string{
+	"bash": bashCompletionSrc,
+	"fish": fishCompletionSrc,
+	"zsh":  zshCompletionSrc,
+}
+
+var completionFormats = []string{
+	"env", "goflags", "json", "make", "shell", "yaml",
+}
+
+// completion prints the completion script of the given shell.
+func (m *mainT) completion() (err error) {
+	var shell string
+	m.a, shell = m.a.Pop()
+	src, ok := completionScripts[shell]
+	if !ok {
+		return config.NewError(config.ErrUsage,
+			"completion: shell must be bash, zsh or fish")
+	}
+	t := template.Must(template.New(shell).Parse(src))
+	if err = t.Execute(os.Stdout, m.p); err == nil {
+		err = egress
+	}
+	return
+}
+
+// complete prints the candidates of the last argument of the hidden
+// __complete command.
+func (m *mainT) complete() error {
+	for _, s := range complete(m.a) {
+		os.Stdout.WriteString(s + "\n")
+	}
+	return egress
+}
+
+// complete returns the candidates of the last word given the previous
+// arguments.
+func complete(words []string) []string {
+	var cmd string
+	var args []string
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	for _, s := range words[:len(words)-1] {
+		if strings.HasPrefix(s, "-") {
+			continue
+		}
+		if cmd == "" {
+			cmd = s
+		} else {
+			args = append(args, s)
+		}
+	}
+	switch {
+	case strings.HasPrefix(cur, "-format="):
+		return withPrefix(prefixAll("-format=", completionFormats), cur)
+	case strings.HasPrefix(cur, "-"):
+		return withPrefix(completionFlags(cmd, args), cur)
+	case cmd == "":
+		return append(withPrefix(completionCommands(), cur),
+			completePackages(cur)...)
+	case cmd == "completion":
+		if len(args) == 0 {
+			return withPrefix([]string{"bash", "fish", "zsh"}, cur)
+		}
+		return nil
+	case cmd == "go" && len(args) == 0:
+		return withPrefix(config.GoSubcommands, cur)
+	case cmd == "get" || cmd == "unset" || cmd == "explain":
+		if len(args) == 0 {
+			return completeEntries(cur)
+		}
+	case cmd == "set":
+		if !strings.HasPrefix(cur, ".") && !strings.HasPrefix(cur, "/") {
+			return completeSettings(cur)
+		}
+	case cmd == "bisect":
+		return nil
+	}
+	return completePackages(cur)
+}
+
+// completionFlags returns those of the command or, without one, the menu:
+// -name of booleans, -name= of values, and both of optional values.
+func completionFlags(name string, args []string) []string {
+	m := new(mainT)
+	fs := m.flagSet("", menuFlags)
+	cmd := command(name)
+	if cmd != nil && cmd.name == "go" && len(args) > 0 {
+		if x := command(args[0]); x != nil && x.gotool {
+			cmd = x
+		}
+	}
+	if cmd != nil && !cmd.raw {
+		fs = m.flagSet(cmd.name, cmd.flags)
+		if cmd.gotool {
+			goFlags(fs, newGoCommand(cmd.name))
+		}
+	}
+	var a []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(*optionalT); ok {
+			a = append(a, "-"+f.Name, "-"+f.Name+"=")
+		} else if isBoolFlag(f) {
+			a = append(a, "-"+f.Name)
+		} else {
+			a = append(a, "-"+f.Name+"=")
+		}
+	})
+	return a
+}
+
+// completionCommands returns the sorted names and aliases of the commands
+// that aren't hidden.
+func completionCommands() []string {
+	var a []string
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			a = append(a, cmd.name)
+			a = append(a, cmd.aliases...)
+		}
+	}
+	sort.Strings(a)
+	return a
+}
+
+// completePackages returns the directories, beginning with the given path,
+// that have a goconfig.yaml or, if it isn't a path, the import paths of such
+// packages within GOPATH.
+func completePackages(cur string) []string {
+	var a []string
+	if strings.HasPrefix(cur, ".") || strings.HasPrefix(cur, "/") {
+		matches, _ := filepath.Glob(cur + "*")
+		for _, dir := range matches {
+			fi, err := os.Stat(dir)
+			if err != nil || !fi.IsDir() {
+				continue
+			}
+			if strings.HasPrefix(cur, "./") &&
+				!strings.HasPrefix(dir, "./") {
+				dir = "./" + dir
+			}
+			_, err = os.Stat(filepath.Join(dir, "goconfig.yaml"))
+			if err == nil {
+				a = append(a, dir)
+			} else {
+				a = append(a, dir+string(os.PathSeparator))
+			}
+		}
+		return a
+	}
+	if g, err := config.NewGoConfig(config.ALL); err == nil {
+		for _, e := range g.Entries {
+			a = append(a, e.Name)
+		}
+	}
+	a = append(a, config.ALL)
+	sort.Strings(a)
+	return withPrefix(a, cur)
+}
+
+// completeEntries returns the entry names of the package in the current
+// directory since that given after the names isn't yet known.
+func completeEntries(cur string) []string {
+	g := completeGoConfig()
+	if g == nil {
+		return nil
+	}
+	var a []string
+	for _, e := range g.Entries {
+		a = append(a, e.Name)
+	}
+	return withPrefix(a, cur)
+}
+
+// completeSettings returns name= of each matching entry or, after the equal
+// sign, the name=value of each choice or boolean value.
+func completeSettings(cur string) []string {
+	g := completeGoConfig()
+	if g == nil {
+		return nil
+	}
+	eq := strings.Index(cur, "=")
+	if eq < 0 {
+		var a []string
+		for _, e := range g.Entries {
+			a = append(a, e.Name+"=")
+		}
+		return withPrefix(a, cur)
+	}
+	e, ok := g.Entry[cur[:eq]]
+	if !ok {
+		return nil
+	}
+	values := e.Choices
+	if e.Init.IsTag() {
+		values = []string{"true", "false"}
+	}
+	return withPrefix(prefixAll(cur[:eq+1], values), cur)
+}
+
+func completeGoConfig() *config.GoConfig {
+	g, err := config.NewGoConfig("")
+	if err != nil || g.IsList() {
+		return nil
+	}
+	return g
+}
+
+func prefixAll(prefix string, words []string) []string {
+	x := make([]string, len(words))
+	for i, s := range words {
+		x[i] = prefix + s
+	}
+	return x
+}
+
+// withPrefix returns the words that begin with the given prefix.
+func withPrefix(words []string, prefix string) []string {
+	var x []string
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			x = append(x, w)
+		}
+	}
+	return x
+}
@@ -0,0 +1,60 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import "strconv"
+
+type Entry struct {
+	Init    *Union
+	Value   *Union
+	Name    string
+	Help    string
+	Choices []string
+	Set     map[string]*Union
+	Reset   map[string]*Union
+	File    string
+	Line    int
+	Import  string
+	History []Change
+	next    string
+	prev    string
+}
+
+// Next returns the name of the following entry or "" if this is the last.
+func (e *Entry) Next() string { return e.next }
+
+// Prev returns the name of the preceding entry or "" if this is the first.
+func (e *Entry) Prev() string { return e.prev }
+
+func (e *Entry) Reinit() {
+	if e.Init == nil {
+		e.Init = NewUnion("")
+	}
+	if e.Value == nil {
+		e.Value = new(Union)
+	}
+	e.Value.Copy(e.Init)
+	e.Record(OriginInit, "")
+}
+
+// IsNumber returns true if the entry is a string initialized with a number.
+func (e *Entry) IsNumber() bool {
+	return e.Init != nil && e.Init.IsString() && isNumber(e.Init.String())
+}
+
+// Record the entry's value as changed by the origin, and source if any.
+func (e *Entry) Record(origin, source string) {
+	e.History = append(e.History, Change{origin, source, e.Value.YAML()})
+}
+
+// isNumber returns true if the text is an integer, in any base prefix of Go, or
+// a decimal floating-point number.
+func isNumber(s string) bool {
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
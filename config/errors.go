@@ -0,0 +1,60 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Error codes of structured (JSON) error output.
+const (
+	ErrCommand      = "command"
+	ErrConflict     = "conflict"
+	ErrForbidden    = "forbidden"
+	ErrInternal     = "internal"
+	ErrInvalidValue = "invalid-value"
+	ErrNotFound     = "not-found"
+	ErrSyntax       = "syntax"
+	ErrUnauthorized = "unauthorized"
+	ErrUnknownEntry = "unknown-entry"
+	ErrUsage        = "usage"
+)
+
+// Error is a goconfig error with a code and, if applicable, the subject entry
+// for editors and CI tools.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Entry   string `json:"entry,omitempty"`
+}
+
+func NewError(code string, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func NewEntryError(code, name string, format string,
+	a ...interface{}) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+		Entry:   name,
+	}
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// WriteJSONError writes the error as,
+//	{"error":{"code":"...","message":"..."[,"entry":"..."]}}
+func WriteJSONError(w io.Writer, err error) error {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{Code: ErrInternal, Message: err.Error()}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		Error *Error `json:"error"`
+	}{e})
+}
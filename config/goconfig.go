@@ -2,7 +2,10 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+// Package config loads the declarations of a package from its goconfig.yaml
+// files, then loads, changes and stores its configuration for the goconfig
+// command and its menus.
+package config
 
 import (
 	"bytes"
@@ -11,17 +14,18 @@ import (
 	"gopkg.in/tgrennan/quotation.v0"
 	"gopkg.in/tgrennan/sos.v0"
 	"gopkg.in/yaml.v1"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 type GoConfig struct {
 	GoConfiguration string
+	Platform
 
 	Package string
 	Dir     string
@@ -29,6 +33,14 @@ type GoConfig struct {
 	End     string
 	Entry   map[string]*Entry
 	Entries []*Entry
+	undo    []stepT
+	redo    []stepT
+	saved   map[string]string
+}
+
+type Platform struct {
+	GOOS   string
+	GOARCH string
 }
 
 type GoCommand struct {
@@ -39,12 +51,9 @@ type GoCommand struct {
 
 const ALL = "all"
 
-var Menu map[string]func(interface{}) error
-var mutex = &sync.Mutex{}
 var veritas = true
-var goos, goarch, goconfiguration string
-var goconfig_goos_goarch, goconfig_goarch, goconfig_goos, goconfig string
-var goconfigs []string
+var platform Platform
+var goconfig = "goconfig.yaml"
 var GoBuildFlags = map[string]bool{
 	"a":    true,
 	"n":    true,
@@ -73,30 +82,20 @@ var GoConfigurableBuildStringFlags = map[string]bool{
 	"installsuffix": true,
 	"ldflags":       true,
 }
+var GoSubcommands = []string{"build", "install", "run", "test"}
 var GoTestFlags = map[string]bool{
 	"c": true,
 	"i": true,
 }
 
 func init() {
-	goos = runtime.GOOS
+	platform.GOOS = runtime.GOOS
 	if s := os.Getenv("GOOS"); s != "" {
-		goos = s
+		platform.GOOS = s
 	}
-	goarch = runtime.GOARCH
+	platform.GOARCH = runtime.GOARCH
 	if s := os.Getenv("GOARCH"); s != "" {
-		goarch = s
-	}
-	goconfig_goos_goarch = "goconfig_" + goos + "_" + goarch + ".yaml"
-	goconfig_goarch = "goconfig_" + goarch + ".yaml"
-	goconfig_goos = "goconfig_" + goos + ".yaml"
-	goconfig = "goconfig.yaml"
-	goconfiguration = "goconfiguration_" + goos + "_" + goarch + ".yaml"
-	goconfigs = []string{
-		goconfig_goos_goarch,
-		goconfig_goarch,
-		goconfig_goos,
-		goconfig,
+		platform.GOARCH = s
 	}
 }
 
@@ -114,8 +113,15 @@ func IsGoFlag(name string) bool {
 }
 
 func NewGoConfig(pkg string) (*GoConfig, error) {
+	return NewGoConfigFor(pkg, platform)
+}
+
+// NewGoConfigFor loads the declarations of the given package for the target
+// GOOS/GOARCH rather than that of the host or environment.
+func NewGoConfigFor(pkg string, p Platform) (*GoConfig, error) {
 	var err error
 	g := new(GoConfig)
+	g.Platform = p
 	g.Entry = make(map[string]*Entry)
 	if pkg == "" || pkg == "." {
 		b, err := exec.Command("go", "list").CombinedOutput()
@@ -141,6 +147,7 @@ func NewGoConfig(pkg string) (*GoConfig, error) {
 			e.Name = name
 			g.Entries = append(g.Entries, e)
 		}
+		g.mark()
 	}
 	return g, err
 }
@@ -202,8 +209,34 @@ func (g *GoConfig) Clean() {
 	g.Entries = g.Entries[:0]
 }
 
+// Clone returns a copy of the configuration with separate entry values.
+func (g *GoConfig) Clone() *GoConfig {
+	x := new(GoConfig)
+	*x = *g
+	x.undo, x.redo = nil, nil
+	x.Entry = make(map[string]*Entry, len(g.Entry))
+	x.Entries = make([]*Entry, 0, len(g.Entries))
+	for _, e := range g.Entries {
+		xe := new(Entry)
+		*xe = *e
+		xe.Value = new(Union)
+		xe.Value.Copy(e.Value)
+		xe.History = append([]Change(nil), e.History...)
+		x.Entry[e.Name] = xe
+		x.Entries = append(x.Entries, xe)
+	}
+	return x
+}
+
 func (g *GoConfig) Exec(s string) ([]byte, error) {
-	a := quotation.Fields(s)
+	return g.Run(quotation.Fields(s))
+}
+
+// Run the given command; if this is "go", run it with GoTool.
+func (g *GoConfig) Run(a []string) ([]byte, error) {
+	if len(a) == 0 {
+		return nil, NewError(ErrUsage, "empty command")
+	}
 	if a[0] == "go" && len(a) > 1 {
 		c, sos := NewGoCommand(sos.SoS(a))
 		return g.GoTool(c, sos)
@@ -211,9 +244,11 @@ func (g *GoConfig) Exec(s string) ([]byte, error) {
 	return exec.Command(a[0], a[1:]...).CombinedOutput()
 }
 
-func (g *GoConfig) GoTool(c *GoCommand, a sos.SoS) ([]byte, error) {
+// GoFlags returns the goconfigured flags that GoTool prepends to the package
+// and arguments of the given command.
+func (g *GoConfig) GoFlags(c *GoCommand) (sos.SoS, error) {
+	a := sos.New()
 	for _, f := range []func(*GoCommand, sos.SoS) (sos.SoS, error){
-		g.pushSubject,
 		g.pushBuildStringFlags,
 		g.pushBuildLDFlag,
 		g.pushBuildTagsFlag,
@@ -226,9 +261,24 @@ func (g *GoConfig) GoTool(c *GoCommand, a sos.SoS) ([]byte, error) {
 			a = xa
 		}
 	}
+	return a, nil
+}
+
+func (g *GoConfig) GoTool(c *GoCommand, a sos.SoS) ([]byte, error) {
+	a, err := g.pushSubject(c, a)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := g.GoFlags(c)
+	if err != nil {
+		return nil, err
+	}
+	a = a.Push(flags...)
 	a = a.Push(c.Name)
 	a = a.Push("go")
-	buf, err := exec.Command(a[0], a[1:]...).CombinedOutput()
+	cmd := exec.Command(a[0], a[1:]...)
+	cmd.Env = g.environ()
+	buf, err := cmd.CombinedOutput()
 	if nt, nok := c.Flags["n"]; nok && nt {
 		s := "#\n# "
 		for _, as := range a {
@@ -258,7 +308,7 @@ func (g *GoConfig) importer(pkg string) error {
 		pkg = filepath.Clean(filepath.Join(g.Dir, pkg))
 		// prefix = "_" + g.Dir
 	}
-	gi, err := NewGoConfig(pkg)
+	gi, err := NewGoConfigFor(pkg, g.Platform)
 	if err != nil {
 		return err
 	}
@@ -280,6 +330,9 @@ func (g *GoConfig) importer(pkg string) error {
 				fixme.Println(g.Package, "ignoring duplicate",
 					iname, "from", pkg)
 			} else {
+				if e.Import == "" {
+					e.Import = g.Package
+				}
 				g.Entry[iname] = e
 				g.insert(iname)
 			}
@@ -347,7 +400,7 @@ func (g *GoConfig) listALL() error {
 				if err != nil {
 					return nil
 				}
-				for _, name := range goconfigs {
+				for _, name := range g.goconfigs() {
 					if filepath.Base(full) == name {
 						dir := filepath.Dir(full)
 						iPath := strings.TrimPrefix(dir,
@@ -366,8 +419,25 @@ func (g *GoConfig) listALL() error {
 	return nil
 }
 
-func (g *GoConfig) Load(config *bytes.Buffer) (err error) {
+// Load the saved configuration or, if non-nil, that given with -config.
+func (g *GoConfig) Load(config *bytes.Buffer) error {
 	if config == nil {
+		return g.LoadFrom(nil, g.GoConfiguration)
+	}
+	return g.LoadFrom(config, "-config")
+}
+
+// LoadFrom loads the saved configuration or, if non-nil, the given buffer
+// from the named source.
+func (g *GoConfig) LoadFrom(config *bytes.Buffer, source string) (err error) {
+	origin := OriginConfig
+	defer func() {
+		if err == nil {
+			g.mark()
+		}
+	}()
+	if config == nil {
+		origin = OriginFile
 		var file *os.File
 		file, err = os.Open(g.GoConfiguration)
 		if err != nil {
@@ -385,11 +455,12 @@ func (g *GoConfig) Load(config *bytes.Buffer) (err error) {
 	}
 	m := make(map[string]interface{})
 	if err = yaml.Unmarshal(config.Bytes(), m); err != nil {
-		return
+		return NewError(ErrSyntax, "%v", err)
 	}
 	for name, v := range m {
 		if e, ok := g.Entry[name]; ok {
 			e.Value.Set(v)
+			e.Record(origin, source)
 		} else {
 			fixme.Println(name, "not found")
 		}
@@ -568,13 +639,19 @@ func (g *GoConfig) pushTestFlags(c *GoCommand, a sos.SoS) (sos.SoS, error) {
 }
 
 func (g *GoConfig) Reinit() {
+	names := make([]string, 0, len(g.Entries))
+	for _, e := range g.Entries {
+		names = append(names, e.Name)
+	}
+	step := g.snapshot(names...)
 	for _, e := range g.Entries {
 		e.Reinit()
 	}
+	g.journal(step)
 }
 
 func (g *GoConfig) search(pkg string) (string, error) {
-	for _, base := range goconfigs {
+	for _, base := range g.goconfigs() {
 		rel := filepath.Join(pkg, base)
 		if _, err := os.Stat(rel); err == nil {
 			return rel, nil
@@ -586,41 +663,65 @@ func (g *GoConfig) search(pkg string) (string, error) {
 			}
 		}
 	}
-	return "", fmt.Errorf("can't find %s",
+	return "", NewError(ErrNotFound, "can't find %s",
 		filepath.Join(g.Package, goconfig))
 }
 
-func (g *GoConfig) Set(name string, s string) bool {
+// Set the named entry to the given text and apply the respective set or reset
+// rule; this returns true if the rule changed other entries.  The history of
+// each changed entry records the given origin, or that of the rule.
+func (g *GoConfig) Set(origin, name, s string) bool {
+	var names []string
+	if e, ok := g.Entry[name]; ok {
+		names = append(names, name)
+		for k := range e.Set {
+			names = append(names, k)
+		}
+		for k := range e.Reset {
+			names = append(names, k)
+		}
+	}
+	step := g.snapshot(names...)
+	defer g.journal(step)
+	return g.set(origin, name, s)
+}
+
+func (g *GoConfig) set(origin, name, s string) bool {
 	var postXset map[string]*Union
+	var rule string
 	if e, ok := g.Entry[name]; ok {
+		was := e.Value.YAML()
 		if e.Value.IsTag() {
 			if t, err := strconv.ParseBool(s); err == nil {
 				if t {
 					e.Value.SetTrue()
-					postXset = e.Set
+					postXset, rule = e.Set, OriginSet
 				} else {
 					e.Value.SetFalse()
-					postXset = e.Reset
+					postXset, rule = e.Reset, OriginReset
 				}
 			}
 		} else if s == "" {
 			e.Value.SetString("")
-			postXset = e.Reset
+			postXset, rule = e.Reset, OriginReset
 		} else {
-			n := len(s) - 1
-			r0, rn := s[0], s[n]
-			if (r0 == '"' && rn == '"') ||
-				(r0 == '\'' && rn == '\'') {
-				e.Value.SetString(s[1:n])
-			} else {
-				e.Value.SetString(s)
-			}
-			postXset = e.Set
+			e.Value.SetString(unquote(s))
+			postXset, rule = e.Set, OriginSet
+		}
+		if e.Value.YAML() != was {
+			e.Record(origin, "")
 		}
 		if len(postXset) > 0 {
 			for k, v := range postXset {
-				ke := g.Entry[k]
-				ke.Value.Copy(v)
+				if ke, ok := g.Entry[k]; ok {
+					was = ke.Value.YAML()
+					ke.Value.Copy(v)
+					if ke.Value.YAML() != was {
+						ke.Record(rule, name)
+					}
+				} else {
+					fixme.Println(name, rule, k, "not found")
+				}
 			}
 			return true
 		}
@@ -630,8 +731,60 @@ func (g *GoConfig) Set(name string, s string) bool {
 	return false
 }
 
+// SetPlatform reloads the declarations and configuration of the package for
+// the given GOOS/GOARCH; this is a conflict while there are unsaved changes
+// since the reload would lose them with their undo and provenance.
+func (g *GoConfig) SetPlatform(p Platform) error {
+	if g.Dirty() {
+		return NewError(ErrConflict,
+			"%s has unsaved changes; save or undo them first",
+			g.Package)
+	}
+	x, err := NewGoConfigFor(g.Package, p)
+	if err != nil {
+		return err
+	}
+	if !x.IsList() {
+		if err = x.Load(nil); err != nil {
+			return err
+		}
+	}
+	*g = *x
+	return nil
+}
+
+// Validate returns an error if the named entry doesn't exist or if Set would
+// ignore the given text or it isn't one of the entry's choices.
+func (g *GoConfig) Validate(name string, s string) error {
+	e, ok := g.Entry[name]
+	if !ok {
+		return NewEntryError(ErrUnknownEntry, name,
+			"unknown entry: %s", name)
+	}
+	if e.Value.IsTag() {
+		if _, err := strconv.ParseBool(s); err != nil {
+			return NewEntryError(ErrInvalidValue, name,
+				"%s: invalid boolean: %s", name, s)
+		}
+	} else if len(e.Choices) > 0 {
+		t := unquote(s)
+		for _, x := range e.Choices {
+			if t == x {
+				return nil
+			}
+		}
+		return NewEntryError(ErrInvalidValue, name,
+			"%s: %q isn't one of: %s", name, t,
+			strings.Join(e.Choices, ", "))
+	} else if t := unquote(s); e.IsNumber() && t != "" && !isNumber(t) {
+		return NewEntryError(ErrInvalidValue, name,
+			"%s: invalid number: %s", name, t)
+	}
+	return nil
+}
+
 func (g *GoConfig) Store() error {
-	w, err := os.Create(filepath.Join(g.Dir, goconfiguration))
+	w, err := os.Create(g.GoConfiguration)
 	if err != nil {
 		return err
 	}
@@ -646,9 +799,23 @@ func (g *GoConfig) Store() error {
 			fmt.Fprintf(w, "%s: %s\n", s, e.Value.YAML())
 		}
 	}
+	g.mark()
 	return nil
 }
 
+// WriteTo writes the value of every entry such that a subsequent Load
+// reproduces this configuration.
+func (g *GoConfig) WriteTo(w io.Writer) (n int64, err error) {
+	for _, e := range g.Entries {
+		var x int
+		x, err = fmt.Fprintf(w, "%s: %s\n", e.Name, e.Value.YAML())
+		if n += int64(x); err != nil {
+			break
+		}
+	}
+	return
+}
+
 func (g *GoConfig) unmarshal(pkg string) error {
 	importList := make([]string, 0)
 	if full, err := g.search(pkg); err != nil {
@@ -657,10 +824,10 @@ func (g *GoConfig) unmarshal(pkg string) error {
 		return err
 	} else {
 		g.Dir = d
-		g.GoConfiguration = filepath.Join(g.Dir, goconfiguration)
+		g.GoConfiguration = filepath.Join(g.Dir, g.goconfiguration())
 	}
 	buf := new(bytes.Buffer)
-	for _, base := range goconfigs {
+	for _, base := range g.goconfigs() {
 		full := filepath.Join(g.Dir, base)
 		if file, err := os.Open(full); os.IsNotExist(err) {
 			continue
@@ -681,6 +848,12 @@ func (g *GoConfig) unmarshal(pkg string) error {
 				return err
 			}
 		}
+		for name, e := range g.Entry {
+			if e.File == "" {
+				e.File = full
+				e.Line = declLine(buf.Bytes(), name)
+			}
+		}
 		for _, s := range importList {
 			if err := g.importer(s); err != nil {
 				return err
@@ -702,7 +875,7 @@ func (g *GoConfig) unmarshal(pkg string) error {
 func (g *GoConfig) unmarshal1(buf []byte, _ *[]string) error {
 	m := make(map[string]*Entry)
 	if err := yaml.Unmarshal(buf, m); err != nil {
-		return fmt.Errorf("first pass %s %v", g.Package, err)
+		return NewError(ErrSyntax, "first pass %s %v", g.Package, err)
 	}
 	for name, x := range m {
 		if name != "import" && !g.Has(name) {
@@ -727,7 +900,8 @@ func (g *GoConfig) unmarshal1(buf []byte, _ *[]string) error {
 func (g *GoConfig) unmarshal2(buf []byte, p *[]string) error {
 	m := make(map[string]*Union)
 	if err := yaml.Unmarshal(buf, m); err != nil {
-		return fmt.Errorf("second pass of %s %v", g.Package, err)
+		return NewError(ErrSyntax, "second pass of %s %v", g.Package,
+			err)
 	}
 	for name, x := range m {
 		if name == "import" {
@@ -753,7 +927,8 @@ func (g *GoConfig) unmarshal2(buf []byte, p *[]string) error {
 func (g *GoConfig) unmarshal3(buf []byte, p *[]string) error {
 	m := make(map[string]string)
 	if err := yaml.Unmarshal(buf, m); err != nil {
-		return fmt.Errorf("fourth pass of %s %v", g.Package, err)
+		return NewError(ErrSyntax, "fourth pass of %s %v", g.Package,
+			err)
 	}
 	for name, x := range m {
 		if name == "import" {
@@ -779,7 +954,8 @@ func (g *GoConfig) unmarshal3(buf []byte, p *[]string) error {
 func (g *GoConfig) unmarshal4(buf []byte, p *[]string) error {
 	m := make(map[string][]string)
 	if err := yaml.Unmarshal(buf, m); err != nil {
-		return fmt.Errorf("third pass of %s %v", g.Package, err)
+		return NewError(ErrSyntax, "third pass of %s %v", g.Package,
+			err)
 	}
 	if a, ok := m["import"]; ok {
 		for _, s := range a {
@@ -789,11 +965,51 @@ func (g *GoConfig) unmarshal4(buf []byte, p *[]string) error {
 	return nil
 }
 
-func AddMenu(name string, f func(interface{}) error) {
-	mutex.Lock()
-	if len(Menu) == 0 {
-		Menu = make(map[string]func(interface{}) error)
+func ParsePlatform(s string) (Platform, error) {
+	var p Platform
+	a := strings.Split(s, "/")
+	if len(a) != 2 || a[0] == "" || a[1] == "" {
+		return p, NewError(ErrUsage, "invalid platform: %s", s)
+	}
+	p.GOOS, p.GOARCH = a[0], a[1]
+	return p, nil
+}
+
+// environ returns the process environment with the target GOOS and GOARCH.
+func (p Platform) environ() []string {
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, s := range os.Environ() {
+		if !strings.HasPrefix(s, "GOOS=") &&
+			!strings.HasPrefix(s, "GOARCH=") {
+			env = append(env, s)
+		}
+	}
+	return append(env, "GOOS="+p.GOOS, "GOARCH="+p.GOARCH)
+}
+
+// goconfigs lists the declaration files in order of precedence.
+func (p Platform) goconfigs() []string {
+	return []string{
+		"goconfig_" + p.GOOS + "_" + p.GOARCH + ".yaml",
+		"goconfig_" + p.GOARCH + ".yaml",
+		"goconfig_" + p.GOOS + ".yaml",
+		goconfig,
 	}
-	Menu[name] = f
-	mutex.Unlock()
+}
+
+func (p Platform) goconfiguration() string {
+	return "goconfiguration_" + p.GOOS + "_" + p.GOARCH + ".yaml"
+}
+
+func (p Platform) String() string { return p.GOOS + "/" + p.GOARCH }
+
+// unquote strips the paired quotes that force string values.
+func unquote(s string) string {
+	if n := len(s) - 1; n > 0 {
+		r0, rn := s[0], s[n]
+		if (r0 == '"' && rn == '"') || (r0 == '\'' && rn == '\'') {
+			return s[1:n]
+		}
+	}
+	return s
 }
@@ -0,0 +1,130 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+// stepT is a journal entry of the values before and after a Set, Unset or
+// Reinit of the GoConfig, including its side effects.
+type stepT []changeT
+
+type changeT struct {
+	name          string
+	before, after *Union
+}
+
+// snapshot returns the current value of the named entries.
+func (g *GoConfig) snapshot(names ...string) stepT {
+	step := make(stepT, 0, len(names))
+	for _, name := range names {
+		if e, ok := g.Entry[name]; ok && e.Value != nil {
+			before := new(Union)
+			before.Copy(e.Value)
+			step = append(step, changeT{name: name, before: before})
+		}
+	}
+	return step
+}
+
+// journal records the step if it changed any value and clears the redo list.
+func (g *GoConfig) journal(step stepT) {
+	changed := stepT{}
+	for _, c := range step {
+		e := g.Entry[c.name]
+		if e.Value.Equal(c.before) {
+			continue
+		}
+		c.after = new(Union)
+		c.after.Copy(e.Value)
+		changed = append(changed, c)
+	}
+	if len(changed) > 0 {
+		g.undo = append(g.undo, changed)
+		g.redo = nil
+	}
+}
+
+// restore the before or after values of the step.
+func (g *GoConfig) restore(step stepT, origin string, after bool) {
+	for _, c := range step {
+		e := g.Entry[c.name]
+		if after {
+			e.Value.Copy(c.after)
+		} else {
+			e.Value.Copy(c.before)
+		}
+		e.Record(origin, "")
+	}
+}
+
+// Unset reinitializes the named entry.
+func (g *GoConfig) Unset(name string) {
+	e, ok := g.Entry[name]
+	if !ok {
+		return
+	}
+	step := g.snapshot(name)
+	e.Reinit()
+	g.journal(step)
+}
+
+// Undo reverts the last Set, Unset or Reinit; this returns false if there's
+// nothing to undo.
+func (g *GoConfig) Undo() bool {
+	if len(g.undo) == 0 {
+		return false
+	}
+	step := g.undo[len(g.undo)-1]
+	g.undo = g.undo[:len(g.undo)-1]
+	g.restore(step, OriginUndo, false)
+	g.redo = append(g.redo, step)
+	return true
+}
+
+// Redo repeats the last undone change; this returns false if there's nothing
+// to redo.
+func (g *GoConfig) Redo() bool {
+	if len(g.redo) == 0 {
+		return false
+	}
+	step := g.redo[len(g.redo)-1]
+	g.redo = g.redo[:len(g.redo)-1]
+	g.restore(step, OriginRedo, true)
+	g.undo = append(g.undo, step)
+	return true
+}
+
+// mark the current values as those loaded or saved.
+func (g *GoConfig) mark() {
+	g.saved = make(map[string]string, len(g.Entries))
+	for _, e := range g.Entries {
+		if e.Value != nil {
+			g.saved[e.Name] = e.Value.YAML()
+		}
+	}
+}
+
+// Dirty returns true if any value differs from that loaded or last saved.
+func (g *GoConfig) Dirty() bool {
+	return g.Diff() != ""
+}
+
+// Diff lists the pending changes of each entry as removed and added lines,
+//	-name: loaded or saved value
+//	+name: current value
+func (g *GoConfig) Diff() string {
+	s := ""
+	for _, e := range g.Entries {
+		if e.Value == nil {
+			continue
+		}
+		was, ok := g.saved[e.Name]
+		if is := e.Value.YAML(); !ok || is != was {
+			if ok {
+				s += "-" + e.Name + ": " + was + "\n"
+			}
+			s += "+" + e.Name + ": " + is + "\n"
+		}
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v1"
+	"sort"
+)
+
+// Lint returns the problems of the given configuration, unknown entries and
+// values that Validate rejects, in order of name.
+func (g *GoConfig) Lint(config []byte) ([]error, error) {
+	var problems []error
+	m := make(map[string]interface{})
+	if err := yaml.Unmarshal(config, m); err != nil {
+		return nil, NewError(ErrSyntax, "%v", err)
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var err error
+		switch v := m[name].(type) {
+		case nil:
+			if !g.Has(name) {
+				err = NewEntryError(ErrUnknownEntry, name,
+					"unknown entry: %s", name)
+			}
+		case string:
+			err = g.Validate(name, v)
+		default:
+			err = g.Validate(name, fmt.Sprint(v))
+		}
+		if err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Change records the value of an entry after it was changed by its origin:
+//
+//	init	declared or reinitialized value
+//	file	saved configuration, the source
+//	config	-config, the source file or Stdin
+//	set	set rule of the source entry
+//	reset	reset rule of the source entry
+//	user	menu or command edit
+//	allyes	allyesconfig
+//	allno	allnoconfig
+//	rand	randconfig
+//	bisect	candidate configuration of bisect
+//	undo	reverted change
+//	redo	repeated change
+type Change struct {
+	Origin string
+	Source string
+	Value  string
+}
+
+const (
+	OriginInit   = "init"
+	OriginFile   = "file"
+	OriginConfig = "config"
+	OriginSet    = "set"
+	OriginReset  = "reset"
+	OriginUser   = "user"
+	OriginAllYes = "allyes"
+	OriginAllNo  = "allno"
+	OriginRand   = "rand"
+	OriginBisect = "bisect"
+	OriginUndo   = "undo"
+	OriginRedo   = "redo"
+)
+
+func (c Change) String() string {
+	switch c.Origin {
+	case OriginSet, OriginReset:
+		return c.Origin + " by " + c.Source + ": " + c.Value
+	case OriginFile, OriginConfig:
+		return c.Origin + " " + c.Source + ": " + c.Value
+	}
+	return c.Origin + ": " + c.Value
+}
+
+// declLine returns the line number of the named top level declaration within
+// the given YAML or 0 if not found.
+func declLine(buf []byte, name string) int {
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for line := 1; scanner.Scan(); line++ {
+		t := scanner.Text()
+		for _, s := range []string{name, strconv.Quote(name),
+			"'" + name + "'"} {
+			if strings.HasPrefix(t, s) &&
+				strings.HasPrefix(strings.TrimLeft(t[len(s):],
+					" \t"), ":") {
+				return line
+			}
+		}
+	}
+	return 0
+}
+
+// Explain describes where the named entry was declared and the chain of
+// changes to its value.
+func (g *GoConfig) Explain(name string) string {
+	e, ok := g.Entry[name]
+	if !ok {
+		return ""
+	}
+	s := name + ": " + e.Value.YAML() + "\n"
+	if e.File != "" {
+		s += "    declared: " + e.File
+		if e.Line > 0 {
+			s += ":" + strconv.Itoa(e.Line)
+		}
+		s += "\n"
+	}
+	if e.Import != "" {
+		s += "    imported by: " + e.Import + "\n"
+	}
+	if len(e.History) > 0 {
+		s += "    history:\n"
+		for _, c := range e.History {
+			s += "        " + c.String() + "\n"
+		}
+	}
+	return s
+}
@@ -0,0 +1,40 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+// AllNo resets every build tag in order such that the reset rules of later
+// entries prevail.
+func (g *GoConfig) AllNo() { g.allTags(OriginAllNo, "false") }
+
+// AllYes sets every build tag in order such that the set rules of later
+// entries prevail.
+func (g *GoConfig) AllYes() { g.allTags(OriginAllYes, "true") }
+
+// RandConfig randomly sets or resets each build tag and selects one of the
+// choices of each such string through the respective set and reset rules.
+func (g *GoConfig) RandConfig(r *rand.Rand) {
+	for _, e := range g.Entries {
+		if e.Value.IsTag() {
+			g.Set(OriginRand, e.Name,
+				strconv.FormatBool(r.Intn(2) == 1))
+		} else if len(e.Choices) > 0 {
+			g.Set(OriginRand, e.Name,
+				`"`+e.Choices[r.Intn(len(e.Choices))]+`"`)
+		}
+	}
+}
+
+func (g *GoConfig) allTags(origin, s string) {
+	for _, e := range g.Entries {
+		if e.Value.IsTag() {
+			g.Set(origin, e.Name, s)
+		}
+	}
+}
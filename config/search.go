@@ -0,0 +1,49 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import "regexp"
+
+// Find returns the next entry after, or with backward, before the given one
+// whose name or help matches the expression; the search wraps around and, if
+// nothing else matches, returns the given entry if it matches or "".
+func (g *GoConfig) Find(re *regexp.Regexp, from string, backward bool) string {
+	step := func(name string) string {
+		e, ok := g.Entry[name]
+		switch {
+		case !ok:
+			return ""
+		case backward && e.prev != "":
+			return e.prev
+		case backward:
+			return g.End
+		case e.next != "":
+			return e.next
+		}
+		return g.Begin
+	}
+	if !g.Has(from) {
+		if from = g.Begin; backward {
+			from = g.End
+		}
+		if g.matches(re, from) {
+			return from
+		}
+	}
+	for name := step(from); name != "" && name != from; name = step(name) {
+		if g.matches(re, name) {
+			return name
+		}
+	}
+	if g.matches(re, from) {
+		return from
+	}
+	return ""
+}
+
+func (g *GoConfig) matches(re *regexp.Regexp, name string) bool {
+	e, ok := g.Entry[name]
+	return ok && (re.MatchString(name) || re.MatchString(e.Help))
+}
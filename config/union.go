@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package main
+package config
 
 import (
 	"gopkg.in/tgrennan/quotation.v0"
@@ -54,6 +54,17 @@ func (u *Union) Equal(x *Union) bool {
 	return u.String() == x.String()
 }
 
+// Interface returns the boolean or string value for encoding, or nil.
+func (u *Union) Interface() interface{} {
+	if u == nil {
+		return nil
+	}
+	if u.IsTag() {
+		return u.IsTrue()
+	}
+	return u.String()
+}
+
 func (u *Union) IsFalse() bool {
 	return u.p == nil
 }
@@ -0,0 +1,9 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This package only builds without both of the b2 and b3 tags, the culprits
+// that bisect should find in bad.yaml.
+package main
+
+func main() {}
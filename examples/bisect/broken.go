@@ -0,0 +1,9 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build b2,b3
+
+package main
+
+var broken int = "b2 and b3"
@@ -0,0 +1,17 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This is a demonstration of a package with choice, multi-line and number
+// strings.
+package main
+
+import "fmt"
+
+var color, greeting, count string
+
+func main() {
+	fmt.Println("color:", color)
+	fmt.Println("count:", count)
+	fmt.Print(greeting)
+}
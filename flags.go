@@ -0,0 +1,120 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"os"
+	"strings"
+)
+
+var flagsFormat = map[string]func([]string) (string, error){
+	"goflags": goflagsFormat,
+	"json":    jsonFormat,
+	"shell":   shellFormat,
+}
+
+// flags prints the arguments that GoTool would add to the given go command
+// (build) for the package.
+func (m *mainT) flags() (err error) {
+	var c *config.GoCommand
+	var a []string
+	var s string
+	format := m.format
+	if format == "" {
+		format = "shell"
+	}
+	f, ok := flagsFormat[format]
+	if !ok {
+		return config.NewError(config.ErrUsage, "invalid format: %s",
+			format)
+	}
+	switch m.a.String(0) {
+	case "go", "build", "install", "run", "test":
+		c, m.a = config.NewGoCommand(m.a)
+	default:
+		c = &config.GoCommand{
+			Name:        "build",
+			Flags:       make(map[string]bool),
+			StringFlags: make(map[string]string),
+		}
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if a, err = m.g.GoFlags(c); err != nil {
+		return
+	}
+	if s, err = f(a); err != nil {
+		return
+	}
+	fmt.Fprintln(os.Stdout, s)
+	return egress
+}
+
+// goflagsFormat joins the arguments as -flag=value settings for the GOFLAGS
+// environment variable; this fails if any value contains spaces.
+func goflagsFormat(a []string) (string, error) {
+	var x []string
+	for i := 0; i < len(a); i++ {
+		name := strings.TrimPrefix(a[i], "-")
+		if name == a[i] {
+			return "", config.NewError(config.ErrInvalidValue,
+				"unexpected argument: %s", a[i])
+		}
+		_, ok := config.GoBuildStringFlags[name]
+		if !ok && name != "tags" {
+			x = append(x, a[i])
+			continue
+		}
+		if i += 1; i == len(a) {
+			return "", config.NewError(config.ErrInvalidValue,
+				"missing %s value", a[i-1])
+		}
+		v := a[i]
+		if name == "tags" {
+			v = strings.Join(strings.Fields(v), ",")
+		}
+		if strings.ContainsAny(v, " \t\n") {
+			return "", config.NewError(config.ErrInvalidValue,
+				"can't express %s in GOFLAGS: %q", a[i-1], v)
+		}
+		x = append(x, "-"+name+"="+v)
+	}
+	return strings.Join(x, " "), nil
+}
+
+func jsonFormat(a []string) (string, error) {
+	if a == nil {
+		a = []string{}
+	}
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+func shellFormat(a []string) (string, error) {
+	x := make([]string, len(a))
+	for i, s := range a {
+		x[i] = shellQuote(s)
+	}
+	return strings.Join(x, " "), nil
+}
+
+// shellQuote returns the string in single quotes if it has any characters
+// that the shell would otherwise interpret.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' || strings.ContainsRune("-_./,=:+@", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
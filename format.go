@@ -0,0 +1,191 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"io"
+	"os"
+	"strings"
+)
+
+// declarationT is the JSON form of a merged declaration.
+type declarationT struct {
+	Name    string                 `json:"name"`
+	Type    string                 `json:"type"`
+	Init    interface{}            `json:"init"`
+	Help    string                 `json:"help,omitempty"`
+	Choices []string               `json:"choices,omitempty"`
+	Set     map[string]interface{} `json:"set,omitempty"`
+	Reset   map[string]interface{} `json:"reset,omitempty"`
+	File    string                 `json:"file,omitempty"`
+	Line    int                    `json:"line,omitempty"`
+	Import  string                 `json:"import,omitempty"`
+}
+
+var showFormat = map[string]func(io.Writer, []*config.Entry) error{
+	"env":  showEnv,
+	"json": showJSON,
+	"make": showMake,
+	"yaml": showYAML,
+}
+
+var declarationsFormat = map[string]func(io.Writer, *config.GoConfig) error{
+	"json": declarationsJSON,
+	"yaml": declarationsYAML,
+}
+
+// declarations prints the merged declarations of the package and its imports.
+func (m *mainT) declarations() (err error) {
+	format := m.format
+	if format == "" {
+		format = "yaml"
+	}
+	f, ok := declarationsFormat[format]
+	if !ok {
+		return config.NewError(config.ErrUsage, "invalid format: %s",
+			format)
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if err = f(os.Stdout, m.g); err == nil {
+		err = egress
+	}
+	return
+}
+
+func declarationsJSON(w io.Writer, g *config.GoConfig) error {
+	unionMap := func(m map[string]*config.Union) map[string]interface{} {
+		if len(m) == 0 {
+			return nil
+		}
+		x := make(map[string]interface{}, len(m))
+		for k, u := range m {
+			x[k] = u.Interface()
+		}
+		return x
+	}
+	a := make([]*declarationT, 0, len(g.Entries))
+	for _, e := range g.Entries {
+		d := &declarationT{
+			Name:    e.Name,
+			Type:    "string",
+			Init:    e.Init.Interface(),
+			Help:    e.Help,
+			Choices: e.Choices,
+			Set:     unionMap(e.Set),
+			Reset:   unionMap(e.Reset),
+			File:    e.File,
+			Line:    e.Line,
+			Import:  e.Import,
+		}
+		if e.Init.IsTag() {
+			d.Type = "bool"
+		}
+		a = append(a, d)
+	}
+	b, err := json.MarshalIndent(a, "", "\t")
+	if err == nil {
+		_, err = fmt.Fprintf(w, "%s\n", b)
+	}
+	return err
+}
+
+func declarationsYAML(w io.Writer, g *config.GoConfig) error {
+	for _, e := range g.Entries {
+		if e.File != "" {
+			_, err := fmt.Fprintf(w, "# %s:%d\n", e.File, e.Line)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, g.Marshal(e.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envName converts the entry name to an environment variable; for example,
+// "main.s1" is "MAIN_S1".
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func showEnv(w io.Writer, entries []*config.Entry) error {
+	for _, e := range entries {
+		_, err := fmt.Fprintf(w, "%s=%s\n", envName(e.Name),
+			shellQuote(e.Value.String()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showJSON writes an object of entry names and values in entry order.
+func showJSON(w io.Writer, entries []*config.Entry) error {
+	s := "{"
+	for i, e := range entries {
+		k, err := json.Marshal(e.Name)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(e.Value.Interface())
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			s += ","
+		}
+		s += "\n\t" + string(k) + ": " + string(v)
+	}
+	if len(entries) > 0 {
+		s += "\n"
+	}
+	_, err := io.WriteString(w, s+"}\n")
+	return err
+}
+
+// showMake writes simply expanded make variables, or multi-line variables
+// with define, named by the entries.
+func showMake(w io.Writer, entries []*config.Entry) error {
+	for _, e := range entries {
+		var err error
+		s := strings.Replace(e.Value.String(), "$", "$$", -1)
+		if strings.Contains(s, "\n") {
+			_, err = fmt.Fprintf(w, "define %s\n%s\nendef\n", e.Name,
+				strings.TrimSuffix(s, "\n"))
+		} else {
+			s = strings.Replace(s, "#", `\#`, -1)
+			_, err = fmt.Fprintf(w, "%s := %s\n", e.Name, s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func showYAML(w io.Writer, entries []*config.Entry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprint(w, e.Name, ": ", e.Value.YAML(),
+			"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"gopkg.in/yaml.v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// keyActionT is a TUI action and the keys bound to it.  The help of the
+// entry and package lists are templates of the tuiT; actions without package
+// help are only available in the entry list.
+type keyActionT struct {
+	name    string
+	keys    []rune
+	prefix  string
+	help    string
+	pkgHelp string
+}
+
+// keyActions are in the order of the TUI help.
+var keyActions = []*keyActionT{
+	{
+		name:    "quit",
+		keys:    []rune{ctrlD, 'q'},
+		help:    "Exit goconfig; this asks to save any changes.",
+		pkgHelp: "Exit goconfig.",
+	},
+	{
+		name: "set",
+		keys: []rune{ctrlM, ctrlJ},
+		help: `Set '{{.Name}}' with the choice picked from a list, the
+text changed in an editor if it has multiple lines, or
+the prompted number or text; ESC cancels.
+If this text is 'true', 'false' or 'nil', then '{{.Name}}'
+is set to the respective value.  You may quote such text to
+force string values; for example: "true", "false", "nil".
+In addition, you may set empty strings with paired quotes
+(i.e. "").`,
+		pkgHelp: "goconfig '{{.Name}}'",
+	},
+	{
+		name: "toggle",
+		keys: []rune{' '},
+		help: "Toggle boolean build tags.",
+	},
+	{
+		name: "edit",
+		keys: []rune{'e'},
+		help: "Edit '{{.Name}}' in a full screen editor; ^S saves.",
+	},
+	{
+		name:    "forward",
+		keys:    []rune{keyDown, ctrlN, '\t', 'j', '+'},
+		prefix:  "[N]",
+		help:    "Advance N (1) entries.",
+		pkgHelp: "Advance N (1) entries.",
+	},
+	{
+		name:    "backward",
+		keys:    []rune{keyUp, ctrlP, shiftTab, 'k', '-'},
+		prefix:  "[N]",
+		help:    "Go back N (1) entries.",
+		pkgHelp: "Go back N (1) entries.",
+	},
+	{
+		name:    "page-down",
+		keys:    []rune{keyPageDown, ctrlF, ctrlV},
+		help:    "Advance a page of entries.",
+		pkgHelp: "Advance a page of entries.",
+	},
+	{
+		name:    "page-up",
+		keys:    []rune{keyPageUp, ctrlB, metaV},
+		help:    "Go back a page of entries.",
+		pkgHelp: "Go back a page of entries.",
+	},
+	{
+		name:    "home",
+		keys:    []rune{keyHome, metaLT, 'H'},
+		help:    "Go to the first entry.",
+		pkgHelp: "Go to the first entry.",
+	},
+	{
+		name:    "end",
+		keys:    []rune{keyEnd, metaGT},
+		help:    "Go to the last entry.",
+		pkgHelp: "Go to the last entry.",
+	},
+	{
+		name:    "refresh",
+		keys:    []rune{ctrlL},
+		help:    "Redraw the screen.",
+		pkgHelp: "Redraw the screen.",
+	},
+	{
+		name: "search",
+		keys: []rune{'/'},
+		help: `Search forward for entries with name or help matching the
+prompted regular expression; matches are highlighted in
+help.`,
+		pkgHelp: `Search forward for the package matching the prompted regular
+expression.`,
+	},
+	{
+		name:    "search-backward",
+		keys:    []rune{'?'},
+		help:    "Search backward or, without a pattern, show this help.",
+		pkgHelp: "Search backward or, without a pattern, show this help.",
+	},
+	{
+		name:    "search-next",
+		keys:    []rune{'n'},
+		help:    "Repeat the last search.",
+		pkgHelp: "Repeat the last search.",
+	},
+	{
+		name:    "search-prev",
+		keys:    []rune{'N'},
+		help:    "Repeat the last search in the opposite direction.",
+		pkgHelp: "Repeat the last search in the opposite direction.",
+	},
+	{
+		name:    "help",
+		keys:    []rune{keyF1},
+		help:    "Show this help.",
+		pkgHelp: "Show this help.",
+	},
+	{
+		name:    "jump",
+		keys:    []rune{':'},
+		help:    "Go to the prompted entry name.",
+		pkgHelp: "Go to the prompted package.",
+	},
+	{
+		name:   "reinit",
+		keys:   []rune{ctrlR},
+		prefix: "[0]",
+		help:   "Reinitialize '{{.Name}}' or all entries with 0 prefix.",
+	},
+	{
+		name:   "undo",
+		keys:   []rune{ctrlZ},
+		prefix: "[N]",
+		help:   "Undo the last N (1) changes.",
+	},
+	{
+		name:   "redo",
+		keys:   []rune{ctrlY},
+		prefix: "[N]",
+		help:   "Redo the last N (1) undone changes.",
+	},
+	{
+		name: "store",
+		keys: []rune{'>'},
+		help: "Save to {{.G.GoConfiguration}}",
+	},
+	{
+		name: "split",
+		keys: []rune{'|'},
+		help: `Show or hide the details of '{{.Name}}' beside the entries
+if the terminal is wide enough.`,
+	},
+	{
+		name: "explain",
+		keys: []rune{'='},
+		help: `Explain where '{{.Name}}' was declared and what changed its
+value.`,
+	},
+	{
+		name: "platform",
+		keys: []rune{'@'},
+		help: `Change the target platform ({{.G.Platform}}) to the prompted
+GOOS/GOARCH.`,
+		pkgHelp: `Change the target platform ({{.G.Platform}}) to the prompted
+GOOS/GOARCH.`,
+	},
+	{
+		name: "exec",
+		keys: []rune{'!'},
+		help: `Run the prompted command, If the command is "go", the first
+period ('.') argument is replaced by the package name and is
+prepended by appropriate goconfigured build flags.`,
+	},
+}
+
+// keyNames are those of the special keys; others are named by the character,
+// ^ and the control character, or M- and the meta character.
+var keyNames = map[rune]string{
+	ctrlM:       "ENTER",
+	'\t':        "TAB",
+	' ':         "SPACE",
+	esc:         "ESC",
+	del:         "DEL",
+	shiftTab:    "S-TAB",
+	metaLT:      "M-<",
+	metaGT:      "M->",
+	keyUp:       "UP",
+	keyDown:     "DOWN",
+	keyRight:    "RIGHT",
+	keyLeft:     "LEFT",
+	keyHome:     "HOME",
+	keyEnd:      "END",
+	keyPageUp:   "PGUP",
+	keyPageDown: "PGDN",
+	keyInsert:   "INSERT",
+	keyDelete:   "DELETE",
+	keyF1:       "F1",
+}
+
+// keyName returns the name of the key used by the help and keys.yaml.
+func keyName(r rune) string {
+	switch s, ok := keyNames[r]; {
+	case ok:
+		return s
+	case r < ' ':
+		return "^" + string('@'+r)
+	case r >= metaA && r <= metaZ:
+		return "M-" + string('a'+r-metaA)
+	}
+	return string(r)
+}
+
+// parseKey returns the key of the given name.
+func parseKey(s string) (rune, error) {
+	for r, name := range keyNames {
+		if strings.EqualFold(s, name) {
+			return r, nil
+		}
+	}
+	switch r, n := utf8.DecodeRuneInString(s); {
+	case n == len(s) && r != utf8.RuneError:
+		return r, nil
+	case len(s) == 2 && r == '^':
+		if c := strings.ToUpper(s)[1]; c >= '@' && c <= '_' {
+			return rune(c - '@'), nil
+		}
+	case len(s) == 3 && strings.HasPrefix(strings.ToUpper(s), "M-"):
+		if c := strings.ToLower(s)[2]; c >= 'a' && c <= 'z' {
+			return metaA + rune(c-'a'), nil
+		}
+	}
+	return 0, config.NewError(config.ErrSyntax, "invalid key: %s", s)
+}
+
+// keysFile returns the name of the user's key bindings,
+// $XDG_CONFIG_HOME/goconfig/keys.yaml or ~/.config/goconfig/keys.yaml
+func keysFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "goconfig", "keys.yaml")
+}
+
+// loadKeys binds the keys of the named file, if it exists, to the respective
+// actions.  The file maps action names to a key or list of keys that replace
+// the default bindings; for example,
+//
+//	forward: [DOWN, "^N", j]
+//	quit: "^D"
+//	search-prev: "N"
+//
+// YAML reads the unquoted n, N, y and Y as booleans, so these must be quoted.
+// Booleans, digits, which prefix counts, and a key bound to more than one
+// action are errors.
+func loadKeys(file string) error {
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m := make(map[string]interface{})
+	if err = yaml.Unmarshal(buf, m); err != nil {
+		return config.NewError(config.ErrSyntax, "%s: %v", file, err)
+	}
+	for name, v := range m {
+		a := keyAction(name)
+		if a == nil {
+			return config.NewError(config.ErrSyntax,
+				"%s: unknown action: %s", file, name)
+		}
+		var names []interface{}
+		switch t := v.(type) {
+		case []interface{}:
+			names = t
+		case nil:
+		default:
+			names = []interface{}{t}
+		}
+		a.keys = a.keys[:0]
+		for _, x := range names {
+			if _, ok := x.(bool); ok {
+				return config.NewError(config.ErrSyntax,
+					"%s: %s: %v isn't a key; quote single-letter"+
+						` keys such as "n" and "y"`, file, name, x)
+			}
+			r, err := parseKey(fmt.Sprint(x))
+			if err != nil {
+				return config.NewError(config.ErrSyntax,
+					"%s: %s: %v", file, name, err)
+			}
+			if r >= '0' && r <= '9' {
+				return config.NewError(config.ErrSyntax,
+					"%s: %s: digits are count prefixes", file,
+					name)
+			}
+			a.keys = append(a.keys, r)
+		}
+	}
+	bound := make(map[rune]string)
+	for _, a := range keyActions {
+		for _, r := range a.keys {
+			if other, ok := bound[r]; ok {
+				return config.NewError(config.ErrSyntax,
+					"%s: %s is bound to %s and %s", file,
+					keyName(r), other, a.name)
+			}
+			bound[r] = a.name
+		}
+	}
+	return nil
+}
+
+// keyAction returns the named action or nil if there isn't one.
+func keyAction(name string) *keyActionT {
+	for _, a := range keyActions {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// keysHelp returns the source of the help template that lists the keys of
+// each action with its entry, or package, help.
+func keysHelp(pkg bool) string {
+	var lines []string
+	for _, a := range keyActions {
+		help := a.help
+		if pkg {
+			help = a.pkgHelp
+		}
+		if help == "" || len(a.keys) == 0 {
+			continue
+		}
+		names := make([]string, len(a.keys))
+		for i, r := range a.keys {
+			names[i] = keyName(r)
+		}
+		s := "    " + a.prefix + strings.Join(names, ", ")
+		switch {
+		case len(s) < 8:
+			s += "\t\t"
+		case len(s) < 16:
+			s += "\t"
+		default:
+			s += "\n\t\t"
+		}
+		lines = append(lines, s+strings.Replace(help, "\n", "\n\t\t", -1))
+	}
+	return "goconfig keys:\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// keys prints the TUI key bindings in the form of keys.yaml.
+func (m *mainT) keys() (err error) {
+	if _, ok := Menu["tui"]; !ok {
+		return config.NewError(config.ErrUsage, "built without tui")
+	}
+	file := keysFile()
+	if err = loadKeys(file); err != nil {
+		return
+	}
+	fmt.Println("#", file)
+	for _, a := range keyActions {
+		names := make([]string, len(a.keys))
+		for i, r := range a.keys {
+			names[i] = strconv.Quote(keyName(r))
+		}
+		fmt.Printf("%s: [%s]\n", a.name, strings.Join(names, ", "))
+	}
+	return egress
+}
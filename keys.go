@@ -2,10 +2,14 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// +build !noTUI
-
 package main
 
+// Control keys of the CLI line editor and the TUI.
+const (
+	esc = '\x1b'
+	del = '\x7f'
+)
+
 const (
 	ctrlSpace = iota
 	ctrlA
@@ -71,3 +75,23 @@ const (
 const (
 	shiftTab = '\u0161'
 )
+
+// Function keys, decoded from the ANSI escape sequences of the terminal, are
+// in the private use area along with the resize and mouse events.
+const (
+	keyUp = iota + '\uf700'
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyPageUp
+	keyPageDown
+	keyInsert
+	keyDelete
+	keyF1
+	keyResize
+	keyMouse
+	keyWheelUp
+	keyWheelDown
+)
@@ -0,0 +1,43 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"os"
+)
+
+// lint prints the problems of the saved, or -config, configuration.
+func (m *mainT) lint() (err error) {
+	var problems []error
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if m.g.IsList() {
+		return errListConfig
+	}
+	source, b := m.source, m.b
+	if b == nil {
+		source = m.g.GoConfiguration
+		b, err = readConfiguration(source)
+		if os.IsNotExist(err) {
+			return egress
+		} else if err != nil {
+			return
+		}
+	}
+	if problems, err = m.g.Lint(b.Bytes()); err != nil {
+		return
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %v\n", source, p)
+	}
+	if len(problems) > 0 {
+		return config.NewError(config.ErrCommand, "%s: %d problem(s)",
+			source, len(problems))
+	}
+	return egress
+}
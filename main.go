@@ -7,30 +7,57 @@ package main
 import (
 	"bytes"
 	"errors"
-	"fmt"
+	"flag"
 	"gopkg.in/tgrennan/fixme.v0"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"gopkg.in/tgrennan/goconfig.v0/web"
 	"gopkg.in/tgrennan/sos.v0"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 )
 
 type mainT struct {
-	p string
-	a sos.SoS
-	f *os.File
-	b *bytes.Buffer
-	g *GoConfig
+	p      string
+	a      sos.SoS
+	f      *os.File
+	b      *bytes.Buffer
+	g      *config.GoConfig
+	format string
+	json   bool
+	source string
+	cmd    *commandT
+	c      *config.GoCommand
+	fs     *flag.FlagSet // of the menu or command; nil if args are go's
+
+	fixmeOpt, configOpt optionalT
+
+	all, helpFlag, versionFlag, cliFlag, showFlag, keepGoing bool
+
+	http, scriptFile, jobs, seedArg, configsArg, matrixArg, out string
+
+	token, htpasswd, goCommands, prefix, tlsCert, tlsKey string
+	readOnly                                             bool
+}
+
+// Script is the CLI menu argument that runs the commands of the given file
+// instead of those from Stdin.
+type Script struct {
+	G         *config.GoConfig
+	File      string
+	KeepGoing bool
 }
 
 const usageSrc = `
-Usage:	{{.Prog}} [flags] [-cli] [package]{{if .WebServer}}
+Usage:	{{.Prog}} [flags] [-cli] [package]
+	{{.Prog}} [flags] -script=<file> [-keep-going] [package]{{if .WebServer}}
 	{{.Prog}} [flags] -http=<server:port>{{end}}
-	{{.Prog}} [flags] -show [-all] [package]
-	{{.Prog}} [flags] <[go] command> [go flags] [package [args]]
+	{{.Prog}} [flags] -show [-all] [-format=<yaml|json|env|make>] [package]
+	{{.Prog}} [flags] <command> [command flags] [arguments]
 
 Flags:
 	-fixme[=<file>]
@@ -40,13 +67,25 @@ Flags:
 		Load configuration from stdin or the given file instead of the
 		default, goconfiguration_GOOS_GOARCH.yaml
 
+	-json
+		Print errors as JSON objects with a code and message; this is
+		implied by -format=json.
+
 Options:{{.TUI}}{{.WebServer}}
-	-show [-all]
-		Instead of a menu, print the configured [or all] entries.
+	-script=<file> [-keep-going]
+		Instead of Stdin, run the CLI commands of the given file;
+		this is the same as the cli command.
+
+	-show [-all] [-format=<yaml|json|env|make>]
+		Instead of a menu, print the configured [or all] entries;
+		this is the same as the show command.
 
-	go <command> [build and test flags] [package [args]]
-		Run the given command with the configured constraints and
-		strings.
+Commands:{{range .Commands}}
+	{{.Synopsis}}
+{{.Indent}}
+{{end}}
+Run "{{.Prog}} <command> -h" for the flags of the command.  The exit status
+is 0 on success, 2 for usage errors, and 1 for other failures.
 
 Goconfig operates on one package per execution unless given ` +
 	"`all`" + `
@@ -61,10 +100,22 @@ var (
 	Version string
 )
 
+var Menu map[string]func(interface{}) error
+var mutex = &sync.Mutex{}
+
 func init() {
 	usage = template.Must(template.New("Usage").Parse(usageSrc[1:]))
 }
 
+func AddMenu(name string, f func(interface{}) error) {
+	mutex.Lock()
+	if len(Menu) == 0 {
+		Menu = make(map[string]func(interface{}) error)
+	}
+	Menu[name] = f
+	mutex.Unlock()
+}
+
 func main() {
 	var err error
 	m := new(mainT)
@@ -76,22 +127,23 @@ func main() {
 			m.f.Close()
 		}
 		if err != nil && err != egress {
-			log.Print(err)
-			exit(1)
+			// -format=json implies -json, even after the package
+			if m.json || m.format == "json" {
+				config.WriteJSONError(os.Stderr, err)
+			} else {
+				log.Print(err)
+			}
+			exit(exitCode(err))
 		}
 	}()
 	m.p = filepath.Base(os.Args[0])
-	m.a = sos.New(os.Args[1:]...)
+	if err = m.parse(os.Args[1:]); err != nil {
+		return
+	}
 	for _, f := range []func() error{
-		m.help,
-		m.version,
 		m.fixme,
 		m.config,
-		m.gotool,
-		m.show,
-		m.webserver,
-		m.tui,
-		m.cli,
+		m.run,
 	} {
 		if err = f(); err != nil {
 			return
@@ -99,19 +151,46 @@ func main() {
 	}
 }
 
-func (m *mainT) arg(name string) string {
-	var s string
-	m.a, s = m.a.Arg(name)
-	return s
+// run the command or, without one, the menu selected by the flags.
+func (m *mainT) run() error {
+	if m.cmd != nil {
+		return m.cmd.run(m)
+	}
+	switch {
+	case m.helpFlag:
+		return m.help()
+	case m.versionFlag:
+		return m.version()
+	case m.showFlag:
+		return m.show()
+	case m.http != "":
+		return m.webserver(m.http)
+	}
+	if _, ok := Menu["tui"]; ok && !m.cliFlag && m.scriptFile == "" {
+		if term := os.Getenv("TERM"); term != "" && term != "DUMB" {
+			return m.tui()
+		}
+	}
+	return m.cli()
 }
 
 func (m *mainT) cli() (err error) {
-	if cli, ok := Menu["cli"]; ok {
-		if err = m.goconfig(); err == nil {
-			if err = cli(m.g); err == nil {
-				err = egress
+	cli, ok := Menu["cli"]
+	if !ok {
+		return config.NewError(config.ErrUsage, "built without cli")
+	}
+	if err = m.goconfig(); err == nil {
+		var v interface{} = m.g
+		if m.scriptFile != "" {
+			v = &Script{
+				G:         m.g,
+				File:      m.scriptFile,
+				KeepGoing: m.keepGoing,
 			}
 		}
+		if err = cli(v); err == nil {
+			err = egress
+		}
 	}
 	return
 }
@@ -119,38 +198,36 @@ func (m *mainT) cli() (err error) {
 func (m *mainT) config() (err error) {
 	var name string
 	var file *os.File
-	if m.flag("config") {
+	if !m.configOpt.set {
+		return
+	}
+	if name = m.configOpt.value; name == "true" {
 		file = os.Stdin
 		name = "Stdin"
-	} else if name = m.arg("config"); name != "" {
+	} else {
 		file, err = os.Open(name)
 		if err != nil {
 			return
 		}
 		defer file.Close()
 	}
-	if file != nil {
-		m.b = new(bytes.Buffer)
-		_, err = m.b.ReadFrom(file)
-	}
+	m.b = new(bytes.Buffer)
+	m.source = name
+	_, err = m.b.ReadFrom(file)
 	return
 }
 
-func (m *mainT) flag(name string) bool {
-	var flag bool
-	m.a, flag = m.a.Flag(name)
-	return flag
-}
-
 func (m *mainT) fixme() (err error) {
-	if m.flag("fixme") {
-		fixme.Enable()
-	} else if name := m.arg("fixme"); name != "" {
-		if m.f, err = os.Create(name); err == nil {
-			fixme.SetWriter(m.f)
-			fixme.Enable()
+	if !m.fixmeOpt.set {
+		return
+	}
+	if name := m.fixmeOpt.value; name != "true" {
+		if m.f, err = os.Create(name); err != nil {
+			return
 		}
+		fixme.SetWriter(m.f)
 	}
+	fixme.Enable()
 	return
 }
 
@@ -158,42 +235,91 @@ func (m *mainT) goconfig() (err error) {
 	var pkg string
 	m.a, pkg = m.a.Pop()
 	if strings.HasPrefix(pkg, "-") {
-		return fmt.Errorf("invalid flag: %s", pkg)
+		return config.NewError(config.ErrUsage, "invalid flag: %s", pkg)
+	}
+	if err = m.trailing(); err != nil {
+		return
 	}
-	if m.g, err = NewGoConfig(pkg); err != nil {
+	if m.g, err = config.NewGoConfig(pkg); err != nil {
 		return
 	}
-	if pkg == ALL {
+	if pkg == config.ALL {
 		fixme.Println(err)
 		return
 	}
-	err = m.g.Load(m.b)
+	if m.b != nil {
+		err = m.g.LoadFrom(m.b, m.source)
+	} else {
+		err = m.g.Load(nil)
+	}
 	return
 }
 
+// gocommand runs go commands other than build, install, run and test with
+// the go flags that follow the command name.
+func (m *mainT) gocommand() error {
+	if len(m.a) == 0 {
+		return config.NewError(config.ErrUsage, "go: missing command")
+	}
+	m.c, m.a = config.NewGoCommand(m.a)
+	return m.gotool()
+}
+
 func (m *mainT) gotool() (err error) {
-	for _, s := range []string{"go", "build", "run", "test", "install"} {
-		if m.a.String(0) == s {
-			var c *GoCommand
-			c, m.a = NewGoCommand(m.a)
-			if err = m.goconfig(); err == nil {
-				var b []byte
-				if b, err = m.g.GoTool(c, m.a); err == nil {
-					os.Stdout.Write(b)
-					err = egress
-				} else {
-					os.Stderr.Write(b)
-				}
-			}
-			break
-		}
+	if m.matrixArg != "" {
+		return m.matrix(m.c, m.matrixArg)
+	}
+	if m.configsArg != "" {
+		return m.configs(m.c, m.configsArg)
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = m.g.GoTool(m.c, m.a); err == nil {
+		os.Stdout.Write(b)
+		err = egress
+	} else {
+		os.Stderr.Write(b)
+		err = config.NewError(config.ErrCommand, "%v", err)
 	}
 	return
 }
 
+// help prints the usage of goconfig or that of the given command.
 func (m *mainT) help() (err error) {
-	var opt struct{ Prog, TUI, WebServer string }
+	var name string
+	if m.a, name = m.a.Pop(); name != "" {
+		cmd := command(name)
+		if cmd == nil || cmd.hidden {
+			return config.NewError(config.ErrUsage,
+				"unknown command: %s", name)
+		}
+		err = m.commandUsage(os.Stdout, cmd)
+	} else {
+		err = usage.Execute(os.Stdout, m.usageOptions())
+	}
+	if err == nil {
+		err = egress
+	}
+	return
+}
+
+// usageOptions returns the parameters of the usage template.
+func (m *mainT) usageOptions() interface{} {
+	var opt struct {
+		Prog, TUI, WebServer string
+		Commands             []*usageCommandT
+	}
 	opt.Prog = m.p
+	for _, cmd := range commands {
+		if !cmd.hidden {
+			opt.Commands = append(opt.Commands, &usageCommandT{
+				Synopsis: cmd.synopsis(),
+				Indent:   cmd.indent(),
+			})
+		}
+	}
 	if _, ok := Menu["tui"]; ok {
 		opt.TUI = `
 	-cli
@@ -205,79 +331,118 @@ func (m *mainT) help() (err error) {
 	}
 	if _, ok := Menu["webserver"]; ok {
 		opt.WebServer = `
-	-http=<server:port>
-		Runs a web server at the given address instead of a TUI or CLI.
+	-http=<server:port> [-token=<token>] [-htpasswd=<file>] [-read-only]
+	    [-go=<command,...>] [-prefix=<path>] [-tls-cert=<file> -tls-key=<file>]
+		Runs a web server at the given address instead of a TUI or CLI;
+		this is the same as the serve command.
 `
 	}
-	if m.a.String(0) == "help" || m.flag("help") {
-		if err = usage.Execute(os.Stdout, opt); err == nil {
-			err = egress
-		}
+	return opt
+}
+
+type usageCommandT struct {
+	Synopsis, Indent string
+}
+
+// serve runs the web server at the address argument.
+func (m *mainT) serve() error {
+	var address string
+	if m.a, address = m.a.Pop(); address == "" {
+		return config.NewError(config.ErrUsage,
+			"serve: missing server:port")
 	}
-	return
+	if err := m.trailing(); err != nil {
+		return err
+	}
+	return m.webserver(address)
 }
 
 func (m *mainT) show() (err error) {
-	var all bool
-	if m.a.String(0) == "show" {
-		m.a, _ = m.a.Pop()
-	} else if !m.flag("show") {
-		return
-	}
-	m.a, all = m.a.Flag("all")
 	if err = m.goconfig(); err != nil {
 		return
 	}
-	err = egress
+	format := m.format
+	if format == "" {
+		format = "yaml"
+	}
+	f, ok := showFormat[format]
+	if !ok {
+		return config.NewError(config.ErrUsage, "invalid format: %s",
+			format)
+	}
+	entries := make([]*config.Entry, 0, len(m.g.Entries))
 	for _, e := range m.g.Entries {
-		if all || !e.Value.Equal(e.Init) {
-			yaml := e.Value.YAML()
-			fmt.Print(e.Name, ": ", yaml, "\n")
+		if m.all || !e.Value.Equal(e.Init) {
+			entries = append(entries, e)
 		}
 	}
+	if err = f(os.Stdout, entries); err == nil {
+		err = egress
+	}
 	return
 }
 
 func (m *mainT) tui() (err error) {
-	if !m.flag("cli") {
-		if term := os.Getenv("TERM"); term != "" && term != "DUMB" {
-			if tui, ok := Menu["tui"]; ok {
-				if err = m.goconfig(); err == nil {
-					if err = tui(m.g); err == nil {
-						err = egress
-					}
-				}
-			}
+	tui, ok := Menu["tui"]
+	if !ok {
+		return config.NewError(config.ErrUsage, "built without tui")
+	}
+	if err = m.goconfig(); err == nil {
+		if err = tui(m.g); err == nil {
+			err = egress
 		}
 	}
 	return
 }
 
 func (m *mainT) version() (err error) {
-	if m.a.String(0) == "version" || m.flag("version") {
-		if Version == "" {
-			Version = "unknown"
-		}
-		os.Stdout.Write([]byte("goconfig version " + Version + "\n"))
-		err = egress
+	if Version == "" {
+		Version = "unknown"
 	}
-	return
+	os.Stdout.Write([]byte("goconfig version " + Version + "\n"))
+	return egress
 }
 
-func (m *mainT) webserver() (err error) {
-	var address string
-	if m.a, address = m.a.Arg("http"); address == "" {
-		return
+// webServer returns the webserver menu argument of the flags; the token
+// defaults to $GOCONFIG_TOKEN so that it needn't be on the command line.
+func (m *mainT) webServer(address string) *web.WebServer {
+	ws := &web.WebServer{
+		Address:  address,
+		Prefix:   m.prefix,
+		Token:    m.token,
+		Htpasswd: m.htpasswd,
+		ReadOnly: m.readOnly,
+		TLSCert:  m.tlsCert,
+		TLSKey:   m.tlsKey,
+	}
+	if ws.Token == "" {
+		ws.Token = os.Getenv("GOCONFIG_TOKEN")
 	}
+	for _, s := range strings.Split(m.goCommands, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ws.GoCommands = append(ws.GoCommands, s)
+		}
+	}
+	return ws
+}
+
+// webserver runs the web server at the address which, without a host, is
+// that of the loopback interface; "0.0.0.0:port" serves all interfaces.
+func (m *mainT) webserver(address string) (err error) {
 	if colon := strings.Index(address, ":"); colon < 0 {
-		err = fmt.Errorf("invalid service address: %s", address)
+		err = config.NewError(config.ErrUsage,
+			"invalid service address: %s", address)
 	} else if _, err = strconv.Atoi(address[colon+1:]); err == nil {
+		if colon == 0 {
+			address = "localhost" + address
+		}
 		if webserver, ok := Menu["webserver"]; ok {
-			if err = webserver(address); err == nil {
+			if err = webserver(m.webServer(address)); err == nil {
 				err = egress
 			}
 		} else {
-			err = errors.New("built without webserver")
+			err = config.NewError(config.ErrUsage,
+				"built without webserver")
 		}
 	}
 	return
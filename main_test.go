@@ -10,11 +10,13 @@ import (
 	"bytes"
 	"fmt"
 	"gopkg.in/tgrennan/fixme.v0"
+	"gopkg.in/tgrennan/goconfig.v0/config"
 	"gopkg.in/tgrennan/sos.v0"
 	"log"
 	"os"
 	"os/exec"
 	"regexp"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -71,6 +73,18 @@ t1: false
 t2: true
 main.s1: The quick brown fox
 main.s2: ""`)
+	test(`goconfig show ./examples/simple -all`, `
+t1: false
+t2: true
+main.s1: The quick brown fox
+main.s2: ""`)
+	test(`goconfig -show ./examples/simple -all`, `
+t1: false
+t2: true
+main.s1: The quick brown fox
+main.s2: ""`)
+	test(`goconfig show ./examples/simple extra 2>&1`, `
+goconfig: unexpected argument: extra`)
 	test("goconfig build -o a.out ./examples/simple", "")
 	test("./a.out", `
 t1: false
@@ -210,11 +224,248 @@ race: false
 #  go run -n -compiler gc examples/buildflags/buildflags.go
 #
 *`)
+	test(`goconfig build -matrix linux/amd64,linux/386 -o a.out.{{.GOARCH}} ./examples/simple`, `
+TARGET
+*linux/amd64
+*linux/386
+*`)
+	test("./a.out.amd64", `
+t1: false
+t2: true
+main.s1: The quick brown fox
+main.s2:`)
+	test(`goconfig build -matrix linux/amd64,linux/386 -o a.out ./examples/simple 2>&1`, `
+goconfig: linux/amd64 and linux/386 would both write a.out; vary -o with {{.GOOS}} and {{.GOARCH}}`)
+	test(`goconfig build -matrix linux 2>&1`, `
+goconfig: invalid platform: linux`)
+	test(`goconfig -config flags examples/buildflags<
+race: false`, `
+-compiler gc`)
+	test(`goconfig -config flags -format=json examples/buildflags<
+race: false`, `
+["-compiler","gc"]`)
+	test(`goconfig -config flags -format=goflags examples/buildflags<
+race: true`, `
+-race -compiler=gc`)
+	test(`goconfig flags ./examples/simple`, `
+-tags t2 -ldflags '-X main.s1 "The quick brown fox"'`)
+	test(`goconfig -config flags -format=goflags ./examples/simple<
+t1: true
+main.s1: ""`, `
+-tags=t1,t2`)
+	test(`goconfig flags -format=goflags ./examples/simple 2>&1`, `
+goconfig: can't express -ldflags in GOFLAGS: "-X main.s1 \"The quick brown fox\""`)
+	test(`goconfig build -configs=allyes,allno,rand:2 -seed=1 ./examples/exclusive`, `
+CONFIG
+*allyes
+*allno
+*rand-1
+*rand-2
+*`)
+	allyesConfiguration := "examples/bisect/goconfiguration_" +
+		runtime.GOOS + "_" + runtime.GOARCH + "-allyes.yaml"
+	test(`goconfig build -configs=allno,allyes ./examples/bisect`, `
+CONFIG
+*allno   *ok
+*allyes  *FAIL *[^ ]* *[^ ]*`+allyesConfiguration)
+	test("rm "+allyesConfiguration, "")
+	test(`goconfig build -configs=rand ./examples/exclusive 2>&1`, `
+goconfig: invalid configs: rand`)
+	test(`goconfig bisect good.yaml bad.yaml ./examples/exclusive 2>&1`, `
+goconfig: bisect: missing -- command`)
+	test(`goconfig bisect -o bisect.yaml examples/bisect/good.yaml examples/bisect/bad.yaml ./examples/bisect -- go vet`, `
+bisect: 5 differences
+*
+culprit: b2: false -> true
+culprit: b3: false -> true
+Wrote: bisect.yaml`)
+	test("cat bisect.yaml", `
+b1: false
+b2: true
+b3: true
+b4: false
+main.s: ""`)
+	test("rm bisect.yaml", "")
+	test(`goconfig get main.s1 ./examples/simple`, `
+The quick brown fox`)
+	test(`goconfig -config get t1 ./examples/simple<
+t1: true`, `
+true`)
+	test(`goconfig get t3 ./examples/simple 2>&1`, `
+goconfig: unknown entry: t3`)
+	test(`goconfig get t1 ./examples/simple extra 2>&1`, `
+goconfig: unexpected argument: extra`)
+	test(`goconfig set t1=maybe ./examples/simple 2>&1`, `
+goconfig: t1: invalid boolean: maybe`)
+	test(`goconfig set t4=true ./examples/simple 2>&1`, `
+goconfig: unknown entry: t4`)
+	test(`goconfig set main.count=many ./examples/typed 2>&1`, `
+goconfig: main.count: invalid number: many`)
+	test(`goconfig set main.color=pink ./examples/typed 2>&1`, `
+goconfig: main.color: "pink" isn't one of: red, green, blue`)
+	simpleConfiguration := "examples/simple/goconfiguration_" +
+		runtime.GOOS + "_" + runtime.GOARCH + ".yaml"
+	test(`goconfig set t1=true main.s2=fox ./examples/simple`, `
+Wrote: .*`+simpleConfiguration)
+	test("cat "+simpleConfiguration, `
+t1: true
+t2: true
+main.s1: The quick brown fox
+main.s2: fox`)
+	test(`goconfig unset t1 ./examples/simple`, `
+Wrote: .*`+simpleConfiguration)
+	test("cat "+simpleConfiguration, `
+t2: true
+main.s1: The quick brown fox
+main.s2: fox`)
+	test("rm "+simpleConfiguration, "")
+	test(`goconfig show -all -format=json ./examples/simple`, `
+{
+	"t1": false,
+	"t2": true,
+	"main.s1": "The quick brown fox",
+	"main.s2": ""
+}`)
+	test(`goconfig show -all -format=env ./examples/simple`, `
+T1=false
+T2=true
+MAIN_S1='The quick brown fox'
+MAIN_S2=''`)
+	test(`goconfig show -all -format=make ./examples/simple`, `
+t1 := false
+t2 := true
+main.s1 := The quick brown fox
+main.s2 :=`)
+	test(`goconfig show -format=xml ./examples/simple 2>&1`, `
+goconfig: invalid format: xml`)
+	test(`goconfig show -format=json examples/wont_find 2>&1`, `
+{"error":{"code":"not-found","message":"can't find examples/wont_find/goconfig.yaml"}}`)
+	test(`goconfig show examples/wont_find -format json 2>&1`, `
+{"error":{"code":"not-found","message":"can't find examples/wont_find/goconfig.yaml"}}`)
+	test(`goconfig show ./examples/simple -format json extra 2>&1`, `
+{"error":{"code":"usage","message":"unexpected argument: extra"}}`)
+	test(`goconfig -json get t3 ./examples/simple 2>&1`, `
+{"error":{"code":"unknown-entry","message":"unknown entry: t3","entry":"t3"}}`)
+	test(`goconfig declarations -format=json ./examples/empty`, `
+[]`)
+	test(`goconfig -config explain t2 ./examples/exclusive<
+t3: true`, `
+t2: false
+    declared:
+*/examples/exclusive/goconfig.yaml:12
+    history:
+        init: false`)
+	test(`goconfig explain t3 ./examples/simple 2>&1`, `
+goconfig: unknown entry: t3`)
+	test(`goconfig -cli ./examples/simple<
+!false
++
+=`, `
+t2: true
+    declared:
+*/examples/simple/goconfig.yaml:6
+    history:
+        init: true`)
+	test(`goconfig -cli ./examples/simple<
+false
+:t1
+maybe
+=t1`, `
+t1: false
+    declared:
+*/examples/simple/goconfig.yaml:5
+    history:
+        init: false\s*$`)
+	test(`goconfig -cli ./examples/simple<
+:main.s1
+n
+:main.s1
+u
+:u
+=main.s1`, `
+main.s1: n
+    declared:
+*/examples/simple/goconfig.yaml:7
+    history:
+        init: The quick brown fox
+        user: n
+        user: u
+        undo: n`)
+	test(`goconfig -cli -script examples/simple/error.gcs ./examples/simple 2>&1`, `
+goconfig: examples/simple/error.gcs: stopped at first error`)
+	test(`goconfig -cli -script examples/simple/error.gcs -keep-going ./examples/simple 2>&1`, `
+goconfig: examples/simple/error.gcs: 1 error(s)`)
+	test(`goconfig completion bash`, `
+# bash completion of goconfig*`)
+	test(`goconfig completion csh 2>&1`, `
+goconfig: completion: shell must be bash, zsh or fish`)
+	test(`goconfig __complete allyes`, `
+allyesconfig`)
+	test(`goconfig __complete go b`, `
+build`)
+	test(`goconfig __complete show -format=y`, `
+-format=yaml`)
+	test(`goconfig __complete show ./examples/si`, `
+./examples/simple`)
+	test(`goconfig __complete -tls`, `
+-tls-cert=
+-tls-key=`)
+	test(`goconfig __complete serve -read`, `
+-read-only`)
+	test(`goconfig __complete show -con`, `
+-config
+-config=`)
+	test(`goconfig __complete go build -rac`, `
+-race`)
+	test(`goconfig show -h`, `
+Usage:	goconfig show*`)
+	test(`goconfig lint -h`, `
+Usage:	goconfig lint \[flags\] \[package\]*`)
+	test(`goconfig help nosuch 2>&1`, `
+goconfig: unknown command: nosuch`)
+	test(`goconfig go 2>&1`, `
+goconfig: go: missing command`)
+	test(`goconfig keys`, `
+forward: \["DOWN", "\^N", "TAB", "j", "\+"\]?`)
+	test(`goconfig -config lint ./examples/simple<
+t1: true
+t4: true`, `
+Stdin: unknown entry: t4`)
 	if failures > 0 {
 		t.Fail()
 	}
 }
 
+// TestBisectApply applies a bad string that unquoting would change.
+func TestBisectApply(t *testing.T) {
+	g, err := config.NewGoConfig("./examples/bisect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bisectT{g: g, bad: g.Clone(), tested: make(map[string]bool)}
+	b.good, err = readConfiguration("examples/bisect/good.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := readConfiguration("examples/bisect/bad.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.bad.Load(bad); err != nil {
+		t.Fatal(err)
+	}
+	x, err := b.apply([]string{"main.s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := x.Entry["main.s"].Value.String(); s != `C:\temp\new` {
+		t.Errorf("main.s: %q", s)
+	}
+	if b.fails([]string{"nosuch"}) || b.err == nil {
+		t.Errorf("nosuch fails: %v", b.err)
+	}
+}
+
 func test(cmd, want string) {
 	pout := &os.Stdout
 	cmd = strings.TrimSpace(cmd)
@@ -0,0 +1,202 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// matrixT is a target of a cross-compilation matrix build.
+type matrixT struct {
+	config.Platform
+	Name    string
+	Package string
+	Exe     string
+	output  string
+	elapsed time.Duration
+	buf     []byte
+	err     error
+}
+
+const matrixOutputSrc = "bin/{{.GOOS}}_{{.GOARCH}}/{{.Name}}{{.Exe}}"
+
+func parseMatrix(s string) ([]*matrixT, error) {
+	var targets []*matrixT
+	seen := make(map[config.Platform]bool)
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		p, err := config.ParsePlatform(field)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[p] {
+			seen[p] = true
+			targets = append(targets, &matrixT{Platform: p})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, config.NewError(config.ErrUsage, "empty matrix: %q",
+			s)
+	}
+	return targets, nil
+}
+
+// matrix builds the package for each GOOS/GOARCH of the given comma separated
+// list with the respective declarations and configuration.
+func (m *mainT) matrix(c *config.GoCommand, spec string) (err error) {
+	var pkg string
+	var targets []*matrixT
+	var output *template.Template
+	jobs := runtime.NumCPU()
+	if c.Name != "build" {
+		return config.NewError(config.ErrUsage,
+			"-matrix doesn't apply to %s", c.Name)
+	}
+	if s := m.jobs; s != "" {
+		if jobs, err = strconv.Atoi(s); err != nil || jobs < 1 {
+			return config.NewError(config.ErrUsage,
+				"invalid jobs: %s", s)
+		}
+	}
+	if targets, err = parseMatrix(spec); err != nil {
+		return
+	}
+	src := matrixOutputSrc
+	if s, ok := c.StringFlags["o"]; ok && s != "" {
+		src = s
+	}
+	if output, err = template.New("output").Parse(src); err != nil {
+		return
+	}
+	m.a, pkg = m.a.Pop()
+	if strings.HasPrefix(pkg, "-") {
+		return config.NewError(config.ErrUsage, "invalid flag: %s", pkg)
+	}
+	if pkg == "" || pkg == "." {
+		var g *config.GoConfig
+		if g, err = config.NewGoConfig(pkg); err != nil {
+			return
+		}
+		pkg = g.Package
+	}
+	// the parallel builds mustn't overwrite each other's output
+	outputs := make(map[string]*matrixT)
+	for _, t := range targets {
+		if err = t.render(pkg, output); err != nil {
+			return
+		}
+		if x, ok := outputs[t.output]; ok {
+			return config.NewError(config.ErrUsage,
+				"%s and %s would both write %s; vary -o with "+
+					"{{.GOOS}} and {{.GOARCH}}", x.Platform,
+				t.Platform, t.output)
+		}
+		outputs[t.output] = t
+	}
+	parallel(len(targets), jobs, func(i int) {
+		targets[i].build(c, pkg, m.b, m.a)
+	})
+	failures := 0
+	for _, t := range targets {
+		if t.err != nil {
+			failures += 1
+			fmt.Fprintf(os.Stderr, "# %s\n", t.Platform)
+			os.Stderr.Write(t.buf)
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tSTATUS\tTIME\tOUTPUT")
+	for _, t := range targets {
+		status := "ok"
+		if t.err != nil {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1fs\t%s\n", t.Platform, status,
+			t.elapsed.Seconds(), t.output)
+	}
+	w.Flush()
+	if failures > 0 {
+		return config.NewError(config.ErrCommand,
+			"%d of %d targets failed", failures, len(targets))
+	}
+	return egress
+}
+
+// render the output file name of the target's package.
+func (t *matrixT) render(pkg string, output *template.Template) error {
+	t.Package = pkg
+	t.Name = filepath.Base(pkg)
+	if t.GOOS == "windows" {
+		t.Exe = ".exe"
+	}
+	o := new(bytes.Buffer)
+	if err := output.Execute(o, t); err != nil {
+		return config.NewError(config.ErrUsage, "%v", err)
+	}
+	t.output = o.String()
+	return nil
+}
+
+func (t *matrixT) build(c *config.GoCommand, pkg string, b *bytes.Buffer,
+	args []string) {
+	var g *config.GoConfig
+	begin := time.Now()
+	defer func() { t.elapsed = time.Since(begin) }()
+	if g, t.err = config.NewGoConfigFor(pkg, t.Platform); t.err != nil {
+		t.buf = []byte(t.err.Error() + "\n")
+		return
+	}
+	if t.err = g.Load(b); t.err != nil {
+		t.buf = []byte(t.err.Error() + "\n")
+		return
+	}
+	if t.err = os.MkdirAll(filepath.Dir(t.output), 0755); t.err != nil {
+		t.buf = []byte(t.err.Error() + "\n")
+		return
+	}
+	tc := &config.GoCommand{
+		Name:        c.Name,
+		Flags:       c.Flags,
+		StringFlags: make(map[string]string),
+	}
+	for k, v := range c.StringFlags {
+		tc.StringFlags[k] = v
+	}
+	tc.StringFlags["o"] = t.output
+	a := make([]string, len(args))
+	copy(a, args)
+	t.buf, t.err = g.GoTool(tc, a)
+}
+
+// parallel calls f with each index of n jobs running at most max at a time.
+func parallel(n, max int, f func(int)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !noTUI
+
+package main
+
+import (
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// splitCols is the narrowest terminal split into the entry list and details.
+const splitCols = 100
+
+// listWidth returns the columns of the entry list, which is the left half of
+// a split screen.
+func (tui *tuiT) listWidth() int {
+	if tui.split && tui.cols >= splitCols {
+		return tui.cols / 2
+	}
+	return tui.cols
+}
+
+// details draws the panel, right of the entry list, with the help, values,
+// choices, set and reset rules, and declaration of the selected entry.
+func (tui *tuiT) details() {
+	left := tui.listWidth()
+	if left == tui.cols {
+		return
+	}
+	width := tui.cols - left - 2
+	var lines []string
+	if e, ok := tui.G.Entry[tui.Name]; ok && !tui.G.IsList() {
+		lines = append(lines, tui.Name, "")
+		if e.Help != "" {
+			lines = append(lines, wrap(e.Help, width)...)
+			lines = append(lines, "")
+		}
+		lines = append(lines, "value: "+oneLine(e.Value.YAML()),
+			"init: "+oneLine(e.Init.YAML()))
+		if len(e.Choices) > 0 {
+			lines = append(lines, wrap("choices: "+
+				strings.Join(e.Choices, ", "), width)...)
+		}
+		lines = append(lines, rules("set", e.Set)...)
+		lines = append(lines, rules("reset", e.Reset)...)
+		if e.File != "" {
+			s := e.File
+			if e.Line > 0 {
+				s += ":" + strconv.Itoa(e.Line)
+			}
+			lines = append(lines, "", "declared: "+s)
+		}
+		if e.Import != "" {
+			lines = append(lines, "imported by: "+e.Import)
+		}
+	}
+	for row := 0; row < tui.rows-1; row++ {
+		var s string
+		if row < len(lines) {
+			s = lines[row]
+		}
+		tui.scr.Move(row, left)
+		tui.scr.Print("│ " + fit(s, width, ' '))
+	}
+}
+
+// oneLine returns the first line of the text with an ellipsis if there are
+// more.
+func oneLine(s string) string {
+	if nl := strings.IndexAny(s, "\n\r"); nl >= 0 {
+		return s[:nl] + "..."
+	}
+	return s
+}
+
+// rules returns the lines of the named set or reset rules.
+func rules(name string, m map[string]*config.Union) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := []string{name + ":"}
+	for _, k := range keys {
+		lines = append(lines, "    "+k+": "+oneLine(m[k].YAML()))
+	}
+	return lines
+}
+
+// wrap returns the lines of text filled to the given width.
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			if line != "" && len(line)+1+len(word) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
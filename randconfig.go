@@ -0,0 +1,188 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// configT is a generated configuration of a -configs test run.
+type configT struct {
+	label   string
+	file    string
+	g       *config.GoConfig
+	elapsed time.Duration
+	buf     []byte
+	err     error
+}
+
+var errListConfig = config.NewError(config.ErrUsage,
+	"can't generate a configuration of all")
+
+// generate stores an allyes, allno or random configuration of the package.
+func (m *mainT) generate() (err error) {
+	var seed int64
+	if seed, err = m.seed(); err != nil {
+		return
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if m.g.IsList() {
+		return errListConfig
+	}
+	m.g.Reinit()
+	switch m.cmd.name {
+	case "allyesconfig":
+		m.g.AllYes()
+	case "allnoconfig":
+		m.g.AllNo()
+	case "randconfig":
+		m.g.RandConfig(rand.New(rand.NewSource(seed)))
+		fmt.Println("seed:", seed)
+	}
+	return m.store()
+}
+
+// configs runs the given build or test command with each of the comma
+// separated allyes, allno and rand:N configurations.
+func (m *mainT) configs(c *config.GoCommand, spec string) (err error) {
+	var seed int64
+	var configs []*configT
+	jobs := runtime.NumCPU()
+	if c.Name != "build" && c.Name != "test" {
+		return config.NewError(config.ErrUsage,
+			"-configs doesn't apply to %s", c.Name)
+	}
+	if s := m.jobs; s != "" {
+		if jobs, err = strconv.Atoi(s); err != nil || jobs < 1 {
+			return config.NewError(config.ErrUsage,
+				"invalid jobs: %s", s)
+		}
+	}
+	if seed, err = m.seed(); err != nil {
+		return
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if m.g.IsList() {
+		return errListConfig
+	}
+	m.g.Reinit()
+	for _, field := range strings.Split(spec, ",") {
+		switch field = strings.TrimSpace(field); {
+		case field == "":
+		case field == "allyes":
+			x := &configT{label: field, g: m.g.Clone()}
+			x.g.AllYes()
+			configs = append(configs, x)
+		case field == "allno":
+			x := &configT{label: field, g: m.g.Clone()}
+			x.g.AllNo()
+			configs = append(configs, x)
+		case strings.HasPrefix(field, "rand:"):
+			n, err := strconv.Atoi(strings.TrimPrefix(field, "rand:"))
+			if err != nil || n < 1 {
+				return config.NewError(config.ErrUsage,
+					"invalid configs: %s", field)
+			}
+			for i := 0; i < n; i++ {
+				x := &configT{
+					label: "rand-" + strconv.FormatInt(seed, 10),
+					g:     m.g.Clone(),
+				}
+				x.g.RandConfig(rand.New(rand.NewSource(seed)))
+				configs = append(configs, x)
+				seed += 1
+			}
+		default:
+			return config.NewError(config.ErrUsage,
+				"invalid configs: %s", field)
+		}
+	}
+	if len(configs) == 0 {
+		return config.NewError(config.ErrUsage, "empty configs: %q",
+			spec)
+	}
+	if c.Name == "build" {
+		// don't race to write the same binary
+		c.StringFlags["o"] = os.DevNull
+	}
+	parallel(len(configs), jobs, func(i int) {
+		configs[i].run(c, m.a)
+	})
+	failures := 0
+	for _, x := range configs {
+		if x.err != nil {
+			failures += 1
+			fmt.Fprintf(os.Stderr, "# %s\n", x.label)
+			os.Stderr.Write(x.buf)
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CONFIG\tSTATUS\tTIME\tFILE")
+	for _, x := range configs {
+		status := "ok"
+		if x.err != nil {
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1fs\t%s\n", x.label, status,
+			x.elapsed.Seconds(), x.file)
+	}
+	w.Flush()
+	if failures > 0 {
+		return config.NewError(config.ErrCommand,
+			"%d of %d configurations failed", failures,
+			len(configs))
+	}
+	return egress
+}
+
+// seed returns the -seed flag value or one from the current time.
+func (m *mainT) seed() (int64, error) {
+	if s := m.seedArg; s != "" {
+		seed, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return 0, config.NewError(config.ErrUsage,
+				"invalid seed: %s", s)
+		}
+		return seed, nil
+	}
+	return time.Now().UnixNano(), nil
+}
+
+// run the command with this configuration and, on failure, save it next to
+// the package's GoConfiguration in a file that may be given to -config to
+// reproduce the failure.
+func (x *configT) run(c *config.GoCommand, args []string) {
+	begin := time.Now()
+	a := make([]string, len(args))
+	copy(a, args)
+	x.buf, x.err = x.g.GoTool(c, a)
+	x.elapsed = time.Since(begin)
+	if x.err == nil {
+		return
+	}
+	name := strings.TrimSuffix(x.g.GoConfiguration, ".yaml") + "-" +
+		x.label + ".yaml"
+	if w, err := os.Create(name); err != nil {
+		x.buf = append(x.buf, []byte(err.Error()+"\n")...)
+	} else {
+		if _, err = x.g.WriteTo(w); err != nil {
+			x.buf = append(x.buf, []byte(err.Error()+"\n")...)
+		}
+		w.Close()
+		x.file = name
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !noCLI
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// lineReader reads the text entered after the given prompt; at the end of
+// input, ReadLine returns io.EOF.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+	Close() error
+}
+
+// completer returns the offset of the word before the cursor and the
+// candidates that may replace it.
+type completer func(s string) (int, []string)
+
+// scanReader is the line reader of piped input.
+type scanReader struct {
+	scanner *bufio.Scanner
+}
+
+// scriptReader echoes each line of a CLI script after the prompt.
+type scriptReader struct {
+	name    string
+	line    int
+	scanner *bufio.Scanner
+}
+
+// editorT is a line editor for terminal input with emacs style keys, history
+// saved across sessions and tab completion.
+type editorT struct {
+	fd       int
+	in       *bufio.Reader
+	buf      []rune
+	pos      int
+	history  []string
+	file     string
+	complete completer
+}
+
+const maxHistory = 500
+
+// newLineReader returns a line editor if Stdin is a terminal; otherwise, a
+// scanner that just prints the prompt.
+func newLineReader(complete completer) lineReader {
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return &scanReader{bufio.NewScanner(os.Stdin)}
+	}
+	ed := &editorT{
+		fd:       fd,
+		in:       bufio.NewReader(os.Stdin),
+		file:     historyFile(),
+		complete: complete,
+	}
+	ed.load()
+	return ed
+}
+
+// historyFile returns the name of the history file in the user's config
+// directory or "" if there isn't one.
+func historyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "goconfig", "history")
+}
+
+func (sr *scanReader) ReadLine(prompt string) (string, error) {
+	print(prompt)
+	if !sr.scanner.Scan() {
+		if err := sr.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return sr.scanner.Text(), nil
+}
+
+func (sr *scanReader) Close() error { return nil }
+
+func newScriptReader(name string, r io.Reader) *scriptReader {
+	return &scriptReader{name: name, scanner: bufio.NewScanner(r)}
+}
+
+func (sr *scriptReader) ReadLine(prompt string) (string, error) {
+	if !sr.scanner.Scan() {
+		if err := sr.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	sr.line += 1
+	t := sr.scanner.Text()
+	print(prompt, t, "\n")
+	return t, nil
+}
+
+func (sr *scriptReader) Close() error { return nil }
+
+func (ed *editorT) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(ed.fd, false)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	ed.buf, ed.pos = ed.buf[:0], 0
+	hist, line := len(ed.history), ""
+	ed.refresh(prompt)
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			os.Stderr.WriteString("\r\n")
+			s := string(ed.buf)
+			ed.add(s)
+			return s, nil
+		case ctrlD:
+			if len(ed.buf) == 0 {
+				os.Stderr.WriteString("\r\n")
+				return "", io.EOF
+			}
+			ed.delete()
+		case ctrlC:
+			os.Stderr.WriteString("^C\r\n")
+			ed.buf, ed.pos = ed.buf[:0], 0
+			hist = len(ed.history)
+		case ctrlA:
+			ed.pos = 0
+		case ctrlE:
+			ed.pos = len(ed.buf)
+		case ctrlB:
+			ed.left()
+		case ctrlF:
+			ed.right()
+		case ctrlH, del:
+			if ed.pos > 0 {
+				ed.pos -= 1
+				ed.delete()
+			}
+		case ctrlK:
+			ed.buf = ed.buf[:ed.pos]
+		case ctrlU:
+			ed.buf = append(ed.buf[:0], ed.buf[ed.pos:]...)
+			ed.pos = 0
+		case ctrlW:
+			i := ed.pos
+			for i > 0 && ed.buf[i-1] == ' ' {
+				i -= 1
+			}
+			for i > 0 && ed.buf[i-1] != ' ' {
+				i -= 1
+			}
+			ed.buf = append(ed.buf[:i], ed.buf[ed.pos:]...)
+			ed.pos = i
+		case ctrlP:
+			hist = ed.recall(hist, hist-1, &line)
+		case ctrlN:
+			hist = ed.recall(hist, hist+1, &line)
+		case ctrlL:
+			os.Stderr.WriteString("\x1b[H\x1b[2J")
+		case '\t':
+			ed.tab()
+		case esc:
+			switch ed.escape() {
+			case 'A':
+				hist = ed.recall(hist, hist-1, &line)
+			case 'B':
+				hist = ed.recall(hist, hist+1, &line)
+			case 'C':
+				ed.right()
+			case 'D':
+				ed.left()
+			case 'H':
+				ed.pos = 0
+			case 'F':
+				ed.pos = len(ed.buf)
+			case '~':
+				ed.delete()
+			}
+		default:
+			if unicode.IsPrint(r) {
+				ed.buf = append(ed.buf, 0)
+				copy(ed.buf[ed.pos+1:], ed.buf[ed.pos:])
+				ed.buf[ed.pos] = r
+				ed.pos += 1
+			}
+		}
+		ed.refresh(prompt)
+	}
+}
+
+// Close saves the most recent history.
+func (ed *editorT) Close() error {
+	if ed.file == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(ed.file), 0755); err != nil {
+		return err
+	}
+	h := ed.history
+	if len(h) > maxHistory {
+		h = h[len(h)-maxHistory:]
+	}
+	s := strings.Join(h, "\n")
+	if s != "" {
+		s += "\n"
+	}
+	f, err := os.Create(ed.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.WriteString(f, s)
+	return err
+}
+
+func (ed *editorT) add(s string) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	if n := len(ed.history); n > 0 && ed.history[n-1] == s {
+		return
+	}
+	ed.history = append(ed.history, s)
+}
+
+func (ed *editorT) delete() {
+	if ed.pos < len(ed.buf) {
+		ed.buf = append(ed.buf[:ed.pos], ed.buf[ed.pos+1:]...)
+	}
+}
+
+// escape reads the rest of an arrow, home, end or delete key sequence and
+// returns its final character of the ANSI form: A, B, C, D, H, F or, for
+// delete, '~'.
+func (ed *editorT) escape() rune {
+	var n rune
+	r, _, err := ed.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	for {
+		if r, _, err = ed.in.ReadRune(); err != nil {
+			return 0
+		}
+		if r < '0' || r > '9' {
+			break
+		}
+		n = r
+	}
+	if r == '~' {
+		switch n {
+		case '1', '7':
+			r = 'H'
+		case '4', '8':
+			r = 'F'
+		case '3':
+		default:
+			r = 0
+		}
+	}
+	return r
+}
+
+func (ed *editorT) left() {
+	if ed.pos > 0 {
+		ed.pos -= 1
+	}
+}
+
+func (ed *editorT) load() {
+	if ed.file == "" {
+		return
+	}
+	f, err := os.Open(ed.file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		ed.add(scanner.Text())
+	}
+}
+
+// recall replaces the line with the i'th history entry, saving the new line
+// while browsing; this returns the resulting index.
+func (ed *editorT) recall(from, i int, line *string) int {
+	if i < 0 || i > len(ed.history) {
+		return from
+	}
+	if from == len(ed.history) {
+		*line = string(ed.buf)
+	}
+	if i == len(ed.history) {
+		ed.buf = []rune(*line)
+	} else {
+		ed.buf = []rune(ed.history[i])
+	}
+	ed.pos = len(ed.buf)
+	return i
+}
+
+func (ed *editorT) refresh(prompt string) {
+	s := "\r" + prompt + string(ed.buf) + "\x1b[K"
+	if n := len(ed.buf) - ed.pos; n > 0 {
+		s += "\x1b[" + strconv.Itoa(n) + "D"
+	}
+	os.Stderr.WriteString(s)
+}
+
+func (ed *editorT) right() {
+	if ed.pos < len(ed.buf) {
+		ed.pos += 1
+	}
+}
+
+// tab completes the word before the cursor with the longest common prefix of
+// the candidates or, if that doesn't extend it, lists them.
+func (ed *editorT) tab() {
+	if ed.complete == nil {
+		return
+	}
+	s := string(ed.buf[:ed.pos])
+	start, candidates := ed.complete(s)
+	if len(candidates) == 0 {
+		return
+	}
+	word := s[start:]
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) {
+		tail := ed.buf[ed.pos:]
+		x := []rune(s[:start] + prefix)
+		ed.buf = append(x, tail...)
+		ed.pos = len(x)
+		return
+	}
+	os.Stderr.WriteString("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+}
@@ -0,0 +1,537 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !noTUI
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"unicode"
+)
+
+// Character attributes of the screen.  The foreground and background colors
+// are the index, plus one, of the 256 color palette in the respective bits;
+// zero is the terminal's default color.
+const (
+	attrNormal   = 0
+	attrBold     = 1 << 0
+	attrUnder    = 1 << 1
+	attrStandout = 1 << 2
+
+	attrFgShift = 8
+	attrBgShift = 17
+	attrFg      = 0x1ff << attrFgShift
+	attrBg      = 0x1ff << attrBgShift
+)
+
+// The basic colors.
+const (
+	colorBlack = iota
+	colorRed
+	colorGreen
+	colorYellow
+	colorBlue
+	colorMagenta
+	colorCyan
+	colorWhite
+)
+
+// screen is the display and keyboard of the TUI; the screenT of the terminal
+// or, in tests, one in memory with scripted keys.
+type screen interface {
+	End() error
+	Size() (int, int)
+	AttrOn(attr int)
+	AttrOff(attr int)
+	Clear()
+	ClearToEOL()
+	Cursor(visible bool)
+	Move(row, col int)
+	Print(a ...interface{})
+	Scroll(n int)
+	GetKey() rune
+	Mouse() (int, int)
+	Update()
+}
+
+// openScreen returns the screen of the TUI; tests replace it.
+var openScreen = func() (screen, error) { return newScreen() }
+
+// screenT is a pure Go, ANSI terminal screen.  Its methods change a buffer of
+// cells that Update, or reading a key, draws on the terminal by rewriting the
+// lines that changed since the last update.
+type screenT struct {
+	fd      int
+	in      *bufio.Reader
+	out     *bufio.Writer
+	restore func() error
+	rows    int
+	cols    int
+	row     int
+	col     int
+	attr    int
+	cursor  bool
+	cells   [][]cellT
+	shown   [][]cellT
+	keys    chan keyT
+	done    chan struct{}
+	winch   chan os.Signal
+	mouse   keyT
+}
+
+// ttyReader reads the raw terminal, whose reads return empty after a tenth of
+// a second without input, until done so that End may stop its reader.
+type ttyReader struct {
+	f    *os.File
+	done chan struct{}
+}
+
+type cellT struct {
+	r    rune
+	attr int
+}
+
+// keyT is a key or, if keyMouse, the position of a click.
+type keyT struct {
+	r        rune
+	row, col int
+}
+
+var (
+	blank          = cellT{r: ' '}
+	errNotTerminal = errors.New("stdin isn't a terminal")
+)
+
+// newScreen puts the Stdin terminal in raw mode and switches to its alternate
+// screen until End.
+func newScreen() (*screenT, error) {
+	scr := &screenT{
+		fd:   int(os.Stdin.Fd()),
+		out:  bufio.NewWriter(os.Stdout),
+		done: make(chan struct{}),
+	}
+	scr.in = bufio.NewReader(ttyReader{os.Stdin, scr.done})
+	if !isTerminal(scr.fd) {
+		return nil, errNotTerminal
+	}
+	rows, cols, err := terminalSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	if scr.restore, err = makeRaw(scr.fd, true); err != nil {
+		return nil, err
+	}
+	scr.resize(rows, cols)
+	scr.keys = make(chan keyT)
+	scr.winch = make(chan os.Signal, 1)
+	if len(resizeSignals) > 0 {
+		signal.Notify(scr.winch, resizeSignals...)
+	}
+	go scr.read()
+	// alternate screen with SGR mouse reports
+	scr.out.WriteString("\x1b[?1049h\x1b[?1000h\x1b[?1006h\x1b[H\x1b[2J")
+	return scr, nil
+}
+
+// End stops reading keys and restores the terminal.
+func (scr *screenT) End() error {
+	close(scr.done)
+	for range scr.keys {
+	}
+	signal.Stop(scr.winch)
+	scr.out.WriteString("\x1b[0m\x1b[?1006l\x1b[?1000l\x1b[?25h" +
+		"\x1b[?1049l")
+	scr.out.Flush()
+	return scr.restore()
+}
+
+// Size returns the number of rows and columns of the screen.
+func (scr *screenT) Size() (int, int) { return scr.rows, scr.cols }
+
+// AttrOn adds the attributes; any colors replace the current ones.
+func (scr *screenT) AttrOn(attr int) {
+	if attr&attrFg != 0 {
+		scr.attr &^= attrFg
+	}
+	if attr&attrBg != 0 {
+		scr.attr &^= attrBg
+	}
+	scr.attr |= attr
+}
+
+// AttrOff removes the attributes; any colors revert to the default.
+func (scr *screenT) AttrOff(attr int) {
+	if attr&attrFg != 0 {
+		attr |= attrFg
+	}
+	if attr&attrBg != 0 {
+		attr |= attrBg
+	}
+	scr.attr &^= attr
+}
+
+// Clear the whole screen and move to its top left corner.
+func (scr *screenT) Clear() {
+	for _, line := range scr.cells {
+		for i := range line {
+			line[i] = blank
+		}
+	}
+	scr.row, scr.col = 0, 0
+}
+
+// ClearToEOL clears the rest of the current line.
+func (scr *screenT) ClearToEOL() {
+	if scr.row >= 0 && scr.row < scr.rows {
+		line := scr.cells[scr.row]
+		for i := scr.col; i < len(line); i++ {
+			line[i] = blank
+		}
+	}
+}
+
+// Cursor shows or hides the cursor.
+func (scr *screenT) Cursor(visible bool) { scr.cursor = visible }
+
+func (scr *screenT) Move(row, col int) { scr.row, scr.col = row, col }
+
+// Print the operands, formatted as by fmt.Print, at the cursor with the
+// current attributes.  Newline clears the rest of the line and tab advances to
+// the next multiple of eight columns; text past the last column wraps.
+func (scr *screenT) Print(a ...interface{}) {
+	for _, r := range fmt.Sprint(a...) {
+		switch {
+		case r == '\n':
+			scr.ClearToEOL()
+			scr.row, scr.col = scr.row+1, 0
+		case r == '\r':
+			scr.col = 0
+		case r == '\t':
+			for n := 8 - scr.col%8; n > 0; n-- {
+				scr.put(' ')
+			}
+		case unicode.IsPrint(r):
+			scr.put(r)
+		}
+	}
+}
+
+// Scroll the lines up, or if negative, down by n.
+func (scr *screenT) Scroll(n int) {
+	for ; n > 0; n-- {
+		line := scr.cells[0]
+		copy(scr.cells, scr.cells[1:])
+		scr.cells[scr.rows-1] = line
+		for i := range line {
+			line[i] = blank
+		}
+	}
+	for ; n < 0; n++ {
+		line := scr.cells[scr.rows-1]
+		copy(scr.cells[1:], scr.cells)
+		scr.cells[0] = line
+		for i := range line {
+			line[i] = blank
+		}
+	}
+}
+
+// GetKey draws the screen then returns the next key.  Function keys and meta
+// (escape prefixed) characters are decoded to the constants of keys.go.  After
+// a change of the terminal size, this returns keyResize with the screen
+// cleared to the new Size.
+func (scr *screenT) GetKey() rune {
+	scr.Update()
+	select {
+	case k, ok := <-scr.keys:
+		if !ok {
+			return ctrlD
+		}
+		if k.r == keyMouse {
+			scr.mouse = k
+		}
+		return k.r
+	case <-scr.winch:
+		rows, cols, err := terminalSize(int(os.Stdout.Fd()))
+		if err == nil {
+			scr.resize(rows, cols)
+			scr.out.WriteString("\x1b[2J")
+		}
+		return keyResize
+	}
+}
+
+// Mouse returns the row and column of the last click.
+func (scr *screenT) Mouse() (int, int) { return scr.mouse.row, scr.mouse.col }
+
+// Update draws the lines that changed on the terminal.
+func (scr *screenT) Update() {
+	attr := -1
+	for row, line := range scr.cells {
+		if equalCells(line, scr.shown[row]) {
+			continue
+		}
+		scr.out.WriteString("\x1b[" + strconv.Itoa(row+1) + "H")
+		for col, c := range line {
+			if row == scr.rows-1 && col == scr.cols-1 {
+				// don't scroll the terminal
+				break
+			}
+			if c.attr != attr {
+				attr = c.attr
+				scr.out.WriteString(sgr(attr))
+			}
+			scr.out.WriteRune(c.r)
+		}
+		copy(scr.shown[row], line)
+	}
+	if attr != -1 {
+		scr.out.WriteString(sgr(attrNormal))
+	}
+	row, col := scr.row, scr.col
+	if row >= scr.rows {
+		row = scr.rows - 1
+	}
+	if col >= scr.cols {
+		col = scr.cols - 1
+	}
+	scr.out.WriteString("\x1b[" + strconv.Itoa(row+1) + ";" +
+		strconv.Itoa(col+1) + "H")
+	if scr.cursor {
+		scr.out.WriteString("\x1b[?25h")
+	} else {
+		scr.out.WriteString("\x1b[?25l")
+	}
+	scr.out.Flush()
+}
+
+// read decodes the input into keys until the end of input.
+func (scr *screenT) read() {
+	defer close(scr.keys)
+	for {
+		r, _, err := scr.in.ReadRune()
+		if err != nil {
+			return
+		}
+		k := keyT{r: r}
+		if r == esc && scr.in.Buffered() > 0 {
+			if k, err = scr.meta(); err != nil {
+				return
+			}
+		}
+		if k.r != 0 {
+			select {
+			case scr.keys <- k:
+			case <-scr.done:
+				return
+			}
+		}
+	}
+}
+
+func (t ttyReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.f.Read(p)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		select {
+		case <-t.done:
+			return 0, io.EOF
+		default:
+		}
+	}
+}
+
+// meta returns the meta character or function key that follows escape.
+func (scr *screenT) meta() (keyT, error) {
+	r, _, err := scr.in.ReadRune()
+	switch {
+	case err != nil:
+	case r == '[' || r == 'O':
+		return scr.escape()
+	case r >= 'a' && r <= 'z':
+		r = metaA + r - 'a'
+	case r >= 'A' && r <= 'Z':
+		r = metaA + r - 'A'
+	case r == '<':
+		r = metaLT
+	case r == '>':
+		r = metaGT
+	}
+	return keyT{r: r}, err
+}
+
+// escape returns the function key or mouse event of the rest of an ANSI
+// sequence; the key is zero for ignored events, such as button releases.
+func (scr *screenT) escape() (keyT, error) {
+	var a []int
+	var n int
+	var mouse bool
+	for {
+		r, _, err := scr.in.ReadRune()
+		switch {
+		case err != nil:
+			return keyT{}, err
+		case r == '<':
+			mouse = true
+			continue
+		case r >= '0' && r <= '9':
+			n = n*10 + int(r-'0')
+			continue
+		case r == ';':
+			a, n = append(a, n), 0
+			continue
+		}
+		a = append(a, n)
+		if mouse {
+			return mouseKey(a, r == 'M'), nil
+		}
+		switch r {
+		case 'A':
+			r = keyUp
+		case 'B':
+			r = keyDown
+		case 'C':
+			r = keyRight
+		case 'D':
+			r = keyLeft
+		case 'H':
+			r = keyHome
+		case 'F':
+			r = keyEnd
+		case 'Z':
+			r = shiftTab
+		case 'P':
+			r = keyF1
+		case '~':
+			switch a[0] {
+			case 1, 7:
+				r = keyHome
+			case 2:
+				r = keyInsert
+			case 3:
+				r = keyDelete
+			case 4, 8:
+				r = keyEnd
+			case 5:
+				r = keyPageUp
+			case 6:
+				r = keyPageDown
+			case 11:
+				r = keyF1
+			default:
+				r = 0
+			}
+		default:
+			r = 0
+		}
+		return keyT{r: r}, nil
+	}
+}
+
+// mouseKey returns the click or wheel event of the SGR mouse report
+// parameters: button, column and row.
+func mouseKey(a []int, press bool) keyT {
+	if len(a) != 3 || !press {
+		return keyT{}
+	}
+	const modifiers = 4 | 8 | 16
+	switch a[0] &^ modifiers {
+	case 0:
+		return keyT{keyMouse, a[2] - 1, a[1] - 1}
+	case 64:
+		return keyT{r: keyWheelUp}
+	case 65:
+		return keyT{r: keyWheelDown}
+	}
+	return keyT{}
+}
+
+func (scr *screenT) put(r rune) {
+	if scr.col >= scr.cols {
+		scr.row, scr.col = scr.row+1, 0
+	}
+	if scr.row < 0 || scr.row >= scr.rows {
+		return
+	}
+	scr.cells[scr.row][scr.col] = cellT{r, scr.attr}
+	scr.col += 1
+}
+
+// resize the buffers to the given size; the shown buffer is invalid so that
+// the next update draws every line.
+func (scr *screenT) resize(rows, cols int) {
+	// Scroll and the cursor need at least one cell
+	if rows < 1 {
+		rows = 1
+	}
+	if cols < 1 {
+		cols = 1
+	}
+	scr.rows, scr.cols = rows, cols
+	scr.cells = make([][]cellT, rows)
+	scr.shown = make([][]cellT, rows)
+	for i := range scr.cells {
+		scr.cells[i] = make([]cellT, cols)
+		scr.shown[i] = make([]cellT, cols)
+		for j := range scr.cells[i] {
+			scr.cells[i][j] = blank
+		}
+	}
+}
+
+func equalCells(a, b []cellT) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fg returns the attribute of the foreground color.
+func fg(color int) int { return (color + 1) << attrFgShift }
+
+// bg returns the attribute of the background color.
+func bg(color int) int { return (color + 1) << attrBgShift }
+
+// sgr returns the Select Graphic Rendition sequence of the attributes.
+func sgr(attr int) string {
+	s := "\x1b[0"
+	if attr&attrBold != 0 {
+		s += ";1"
+	}
+	if attr&attrUnder != 0 {
+		s += ";4"
+	}
+	if attr&attrStandout != 0 {
+		s += ";7"
+	}
+	if c := (attr & attrFg) >> attrFgShift; c != 0 {
+		s += sgrColor(c-1, 30, 90, 38)
+	}
+	if c := (attr & attrBg) >> attrBgShift; c != 0 {
+		s += sgrColor(c-1, 40, 100, 48)
+	}
+	return s + "m"
+}
+
+// sgrColor returns the parameter of a basic, bright or 256 palette color.
+func sgrColor(c, basic, bright, palette int) string {
+	switch {
+	case c < 8:
+		return ";" + strconv.Itoa(basic+c)
+	case c < 16:
+		return ";" + strconv.Itoa(bright+c-8)
+	}
+	return ";" + strconv.Itoa(palette) + ";5;" + strconv.Itoa(c)
+}
@@ -0,0 +1,29 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"regexp"
+)
+
+// compileSearch returns the expression of a search command; an empty pattern
+// repeats the last one.
+func compileSearch(pattern string, last *regexp.Regexp) (*regexp.Regexp,
+	error) {
+	if pattern == "" {
+		if last == nil {
+			return nil, config.NewError(config.ErrUsage,
+				"no previous search pattern")
+		}
+		return last, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, config.NewError(config.ErrUsage,
+			"invalid search pattern: %v", err)
+	}
+	return re, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"strings"
+)
+
+// get prints the value of the named entry.
+func (m *mainT) get() (err error) {
+	var name string
+	if m.a, name = m.a.Pop(); name == "" {
+		return config.NewError(config.ErrUsage,
+			"get: missing entry name")
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	e, ok := m.g.Entry[name]
+	if !ok {
+		return config.NewEntryError(config.ErrUnknownEntry, name,
+			"unknown entry: %s", name)
+	}
+	fmt.Println(e.Value.String())
+	return egress
+}
+
+// set validates then applies each name=value through the set and reset rules
+// before storing the configuration.
+func (m *mainT) set() (err error) {
+	var names, values []string
+	for {
+		s := m.a.String(0)
+		eq := strings.Index(s, "=")
+		if eq <= 0 || strings.HasPrefix(s, "-") {
+			break
+		}
+		m.a, _ = m.a.Pop()
+		names = append(names, s[:eq])
+		values = append(values, s[eq+1:])
+	}
+	if len(names) == 0 {
+		return config.NewError(config.ErrUsage,
+			"set: missing name=value")
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	for i, name := range names {
+		if err = m.g.Validate(name, values[i]); err != nil {
+			return
+		}
+	}
+	for i, name := range names {
+		m.g.Set(config.OriginUser, name, values[i])
+	}
+	return m.store()
+}
+
+// unset reinitializes the named entry before storing the configuration.
+func (m *mainT) unset() (err error) {
+	var name string
+	if m.a, name = m.a.Pop(); name == "" {
+		return config.NewError(config.ErrUsage,
+			"unset: missing entry name")
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if !m.g.Has(name) {
+		return config.NewEntryError(config.ErrUnknownEntry, name,
+			"unknown entry: %s", name)
+	}
+	m.g.Unset(name)
+	return m.store()
+}
+
+func (m *mainT) store() error {
+	if m.g.IsList() {
+		return config.NewError(config.ErrUsage, "can't store all")
+	}
+	if err := m.g.Store(); err != nil {
+		return err
+	}
+	fmt.Println("Wrote:", m.g.GoConfiguration)
+	return egress
+}
+
+// explain prints the declaration and changes of the named entry.
+func (m *mainT) explain() (err error) {
+	var name string
+	if m.a, name = m.a.Pop(); name == "" {
+		return config.NewError(config.ErrUsage,
+			"explain: missing entry name")
+	}
+	if err = m.goconfig(); err != nil {
+		return
+	}
+	if !m.g.Has(name) {
+		return config.NewEntryError(config.ErrUnknownEntry, name,
+			"unknown entry: %s", name)
+	}
+	fmt.Print(m.g.Explain(name))
+	return egress
+}
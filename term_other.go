@@ -0,0 +1,22 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTerminal = errors.New("terminal mode isn't supported")
+
+func isTerminal(fd int) bool { return false }
+
+func terminalSize(fd int) (int, int, error) { return 0, 0, errNoTerminal }
+
+func makeRaw(fd int, timeout bool) (func() error, error) { return nil, errNoTerminal }
+
+var resizeSignals []os.Signal
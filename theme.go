@@ -0,0 +1,62 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !noTUI
+
+package main
+
+import "os"
+
+// themeT has the screen attributes of the TUI elements.
+type themeT struct {
+	Normal   int // entry values
+	Entry    int // the selected entry
+	Status   int // the status line and titles
+	Modified int // values that differ from their init
+	Match    int // search matches in help
+}
+
+// themes are selected by $GOCONFIG_THEME; mono, without colors, is used if
+// $NO_COLOR is set.
+var themes = map[string]themeT{
+	"default": {
+		Normal:   attrNormal,
+		Entry:    attrStandout,
+		Status:   attrBold,
+		Modified: fg(colorCyan),
+		Match:    attrBold | fg(colorYellow),
+	},
+	"dark": {
+		Normal:   fg(colorWhite),
+		Entry:    fg(colorBlack) | bg(colorCyan),
+		Status:   attrBold | fg(colorWhite) | bg(colorBlue),
+		Modified: attrBold | fg(colorYellow),
+		Match:    attrBold | fg(colorGreen),
+	},
+	"light": {
+		Normal:   fg(colorBlack),
+		Entry:    fg(colorWhite) | bg(colorBlue),
+		Status:   attrBold | fg(colorBlack) | bg(colorCyan),
+		Modified: attrBold | fg(colorMagenta),
+		Match:    attrUnder | fg(colorRed),
+	},
+	"mono": {
+		Normal:   attrNormal,
+		Entry:    attrStandout,
+		Status:   attrBold,
+		Modified: attrUnder,
+		Match:    attrBold | attrUnder,
+	},
+}
+
+// tuiTheme returns the theme of the environment; unknown themes are default.
+func tuiTheme() themeT {
+	if os.Getenv("NO_COLOR") != "" {
+		return themes["mono"]
+	}
+	if t, ok := themes[os.Getenv("GOCONFIG_THEME")]; ok {
+		return t
+	}
+	return themes["default"]
+}
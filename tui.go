@@ -8,143 +8,108 @@ package main
 
 import (
 	"bytes"
-	"code.google.com/p/goncurses"
 	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"regexp"
 	"strings"
 	"text/template"
 	"unicode"
 )
 
 type tuiT struct {
-	G       *GoConfig
+	G       *config.GoConfig
 	Name    string
 	rows    int
 	cols    int
 	row     int
 	msg     string
 	pkg     string
-	scr     *goncurses.Window
-	command map[goncurses.Key]func(*tuiT, int)
+	scr     screen
+	command map[rune]func(*tuiT, int)
 	help    *template.Template
-	show    func(string, int, goncurses.Char)
+	show    func(string, int, int)
+	search  *regexp.Regexp
+	reverse bool
+	split   bool
+	done    bool
+	theme   themeT
 }
 
-const (
-	NormalAttr = goncurses.A_NORMAL
-	EntryAttr  = goncurses.A_STANDOUT
-	StatusAttr = goncurses.A_BOLD
-)
-
-const tuiEntryHelpSrc = `
-goconfig keys:
-    EOF		Exit goconfig.
-    ENTER	Set '{{.Name}}' with the prompted text.
-		If this text is 'true', 'false' or 'nil', then '{{.Name}}'
-		is set to the respective value.  You may quote such text to
-		force string values; for example: "true", "false", "nil".
-		In addition, you may set empty strings with paired quotes
-		(i.e. "").
-    SPACE	Toggle boolean build tags.
-    [N]DOWN	Advance N (1) entries.
-    [N]UP	Go back N (1) entries.
-    [0]^R	Reinitialize '{{.Name}}' or all entries with 0 prefix.
-    >		Save to {{.G.GoConfiguration}}
-    !		Run the prompted command, If the command is "go", the first
-		period ('.') argument is replaced by the package name and is
-		prepended by appropriate goconfigured build flags.
-
-{{.Marshal}}
-`
-const tuiPkgHelpSrc = `
-goconfig keys:
-    EOF		Exit goconfig.
-    ENTER	goconfig '{{.Name}}'
-    [N]DOWN	Advance N (1) entries.
-    [N]UP	Go back N (1) entries.
-`
-
 var tuiEntryHelp, tuiPkgHelp *template.Template
-var tuiEntryCommands = map[goncurses.Key]func(*tuiT, int){
-	'?':                  tuiHelp,
-	goncurses.KEY_UP:     tuiBackward,
-	ctrlP:                tuiBackward,
-	shiftTab:             tuiBackward,
-	'k':                  tuiBackward,
-	'-':                  tuiBackward,
-	goncurses.KEY_DOWN:   tuiForward,
-	ctrlN:                tuiForward,
-	'\t':                 tuiForward,
-	'j':                  tuiForward,
-	'+':                  tuiForward,
-	goncurses.KEY_PAGEUP: tuiPageUp,
-	ctrlB:                tuiPageUp,
-	metaV:                tuiPageUp,
-	goncurses.KEY_PAGEDOWN: tuiPageDown,
-	ctrlF:              tuiPageDown,
-	ctrlV:              tuiPageDown,
-	goncurses.KEY_HOME: tuiHome,
-	metaLT:             tuiHome,
-	'H':                tuiHome,
-	goncurses.KEY_END:  tuiEnd,
-	metaGT:             tuiEnd,
-	ctrlL:              tuiRefresh,
-
-	goncurses.KEY_RETURN: tuiSet,
-	goncurses.KEY_ENTER:  tuiSet,
-	ctrlR:                tuiReinit,
-	' ':                  tuiToggle,
-	'>':                  tuiStore,
-	'!':                  tuiExec,
-}
-var tuiPkgCommands = map[goncurses.Key]func(*tuiT, int){
-	'?':                  tuiHelp,
-	goncurses.KEY_UP:     tuiBackward,
-	ctrlP:                tuiBackward,
-	shiftTab:             tuiBackward,
-	'k':                  tuiBackward,
-	'-':                  tuiBackward,
-	goncurses.KEY_DOWN:   tuiForward,
-	ctrlN:                tuiForward,
-	'\t':                 tuiForward,
-	'j':                  tuiForward,
-	'+':                  tuiForward,
-	goncurses.KEY_PAGEUP: tuiPageUp,
-	ctrlB:                tuiPageUp,
-	metaV:                tuiPageUp,
-	goncurses.KEY_PAGEDOWN: tuiPageDown,
-	ctrlF:              tuiPageDown,
-	ctrlV:              tuiPageDown,
-	goncurses.KEY_HOME: tuiHome,
-	metaLT:             tuiHome,
-	'H':                tuiHome,
-	goncurses.KEY_END:  tuiEnd,
-	metaGT:             tuiEnd,
-	ctrlL:              tuiRefresh,
-
-	goncurses.KEY_RETURN: tuiGoConfig,
-	goncurses.KEY_ENTER:  tuiGoConfig,
+var tuiEntryCommands, tuiPkgCommands map[rune]func(*tuiT, int)
+
+// tuiEntryActions and tuiPkgActions are the functions of the keyActions in
+// the entry and package lists.
+var tuiEntryActions = map[string]func(*tuiT, int){
+	"quit":            tuiQuit,
+	"set":             tuiSet,
+	"toggle":          tuiToggle,
+	"edit":            tuiEdit,
+	"forward":         tuiForward,
+	"backward":        tuiBackward,
+	"page-down":       tuiPageDown,
+	"page-up":         tuiPageUp,
+	"home":            tuiHome,
+	"end":             tuiEnd,
+	"refresh":         tuiRefresh,
+	"search":          tuiSearch,
+	"search-backward": tuiSearchBackward,
+	"search-next":     tuiSearchNext,
+	"search-prev":     tuiSearchPrev,
+	"help":            tuiHelp,
+	"jump":            tuiJump,
+	"reinit":          tuiReinit,
+	"undo":            tuiUndo,
+	"redo":            tuiRedo,
+	"store":           tuiStore,
+	"split":           tuiSplit,
+	"explain":         tuiExplain,
+	"platform":        tuiPlatform,
+	"exec":            tuiExec,
+}
+var tuiPkgActions = map[string]func(*tuiT, int){
+	"quit":            tuiQuit,
+	"set":             tuiGoConfig,
+	"forward":         tuiForward,
+	"backward":        tuiBackward,
+	"page-down":       tuiPageDown,
+	"page-up":         tuiPageUp,
+	"home":            tuiHome,
+	"end":             tuiEnd,
+	"refresh":         tuiRefresh,
+	"search":          tuiSearch,
+	"search-backward": tuiSearchBackward,
+	"search-next":     tuiSearchNext,
+	"search-prev":     tuiSearchPrev,
+	"help":            tuiHelp,
+	"jump":            tuiJump,
+	"platform":        tuiPlatform,
 }
 
 func init() { AddMenu("tui", __tui__) }
 
 func __tui__(v interface{}) (err error) {
+	if err = loadKeys(keysFile()); err != nil {
+		return err
+	}
 	tuiEntryHelp = template.Must(template.New("tuiEntryHelp").Parse(
-		tuiEntryHelpSrc[1:]))
+		keysHelp(false) + "\n{{.Marshal}}\n"))
 	tuiPkgHelp = template.Must(template.New("tuiPkgHelp").Parse(
-		tuiPkgHelpSrc[1:]))
+		keysHelp(true)))
+	tuiEntryCommands = tuiCommands(tuiEntryActions)
+	tuiPkgCommands = tuiCommands(tuiPkgActions)
 	tui := new(tuiT)
-	tui.G = v.(*GoConfig)
+	tui.G = v.(*config.GoConfig)
 	if err = tui.init(); err != nil {
 		return err
 	}
-outerLoop:
-	for n := -1; true; n = -1 {
-		goncurses.Cursor(0)
-		goncurses.Echo(false)
-		tui.show(tui.Name, tui.row, EntryAttr)
+	for n := -1; !tui.done; n = -1 {
+		tui.scr.Cursor(false)
+		tui.show(tui.Name, tui.row, tui.theme.Entry)
+		tui.details()
 		tui.status(tui.msg)
 	getkeyLoop:
-		key := tui.scr.GetChar()
+		key := tui.key()
 		if unicode.IsDigit(rune(key)) {
 			if n < 0 {
 				n = 0
@@ -156,17 +121,15 @@ outerLoop:
 		if n < 0 {
 			n = 1
 		}
-		tui.show(tui.Name, tui.row, NormalAttr)
-		if key == ctrlD || key == 'q' {
-			break outerLoop
-		} else if f, ok := tui.command[key]; ok {
+		tui.show(tui.Name, tui.row, tui.theme.Normal)
+		if f, ok := tui.command[key]; ok {
 			f(tui, n)
 		} else {
 			tui.msg = "Ignored unassigned key."
 
 		}
 	}
-	goncurses.End()
+	tui.scr.End()
 	return
 }
 
@@ -176,21 +139,68 @@ func tuiBackward(tui *tuiT, n int) {
 		if !ok {
 			break
 		}
-		s := e.prev
+		s := e.Prev()
 		if s == "" {
 			break
 		}
 		tui.Name = s
 		if tui.row -= 1; tui.row == -1 {
 			tui.row = 0
-			tui.scr.ScrollOk(true)
 			tui.scr.Scroll(-1)
-			tui.scr.ScrollOk(false)
-			tui.show(s, tui.row, NormalAttr)
+			tui.show(s, tui.row, tui.theme.Normal)
 		}
 	}
 }
 
+// tuiEdit changes a string entry with the full screen editor.
+func tuiEdit(tui *tuiT, _ int) {
+	name := tui.Name
+	e, ok := tui.G.Entry[name]
+	if !ok || e.Value.IsTag() {
+		tui.Error(config.NewEntryError(config.ErrInvalidValue, name,
+			"%s: isn't a string", name))
+		return
+	}
+	v := e.Value.String()
+	s, ok := tui.edit(name, v, func(s string) error {
+		return tui.G.Validate(name, s)
+	})
+	if ok && s != v {
+		tui.G.Set(config.OriginUser, name, s)
+	}
+	tui.refresh()
+}
+
+// tuiClick selects the clicked entry or, if already selected, toggles or sets
+// it.
+func tuiClick(tui *tuiT, _ int) {
+	row, col := tui.scr.Mouse()
+	if row >= tui.rows-1 || col >= tui.listWidth() {
+		return
+	}
+	name := tui.Name
+	for i := tui.row; i < row && name != ""; i++ {
+		name = tui.G.Entry[name].Next()
+	}
+	for i := tui.row; i > row && name != ""; i-- {
+		name = tui.G.Entry[name].Prev()
+	}
+	if name == "" {
+		return
+	}
+	if row != tui.row {
+		tui.Name, tui.row = name, row
+		return
+	}
+	if tui.G.IsList() {
+		tuiGoConfig(tui, 1)
+	} else if e := tui.G.Entry[name]; e.Value != nil && e.Value.IsTag() {
+		tuiToggle(tui, 1)
+	} else {
+		tuiSet(tui, 1)
+	}
+}
+
 func tuiEnd(tui *tuiT, _ int) {
 	for tui.Name != tui.G.End {
 		tuiForward(tui, 1)
@@ -210,13 +220,19 @@ func tuiExec(tui *tuiT, _ int) {
 	}
 }
 
+func tuiExplain(tui *tuiT, _ int) {
+	tui.popup(func(_ ...interface{}) {
+		fmt.Fprint(tui, tui.G.Explain(tui.Name))
+	})
+}
+
 func tuiForward(tui *tuiT, n int) {
 	for i := 0; i < n; i++ {
 		e, ok := tui.G.Entry[tui.Name]
 		if !ok {
 			break
 		}
-		s := e.next
+		s := e.Next()
 		if s == "" {
 			break
 		}
@@ -224,17 +240,16 @@ func tuiForward(tui *tuiT, n int) {
 		if tui.row += 1; tui.row == tui.rows-1 {
 			tui.scr.Move(tui.row, 0)
 			tui.scr.ClearToEOL()
-			tui.show(s, tui.row, NormalAttr)
-			tui.scr.ScrollOk(true)
+			tui.show(s, tui.row, tui.theme.Normal)
 			tui.scr.Scroll(1)
-			tui.scr.ScrollOk(false)
 			tui.row -= 1
 		}
 	}
 }
 
 func tuiGoConfig(tui *tuiT, _ int) {
-	if g, err := NewGoConfig(tui.Name); err == nil {
+	g, err := config.NewGoConfigFor(tui.Name, tui.G.Platform)
+	if err == nil {
 		if err = g.Load(nil); err != nil {
 			tui.Error(err)
 		}
@@ -252,9 +267,11 @@ func tuiGoConfig(tui *tuiT, _ int) {
 
 func tuiHelp(tui *tuiT, _ int) {
 	tui.popup(func(_ ...interface{}) {
-		if err := tui.help.Execute(tui, tui); err != nil {
+		buf := new(bytes.Buffer)
+		if err := tui.help.Execute(buf, tui); err != nil {
 			fmt.Fprintln(tui, err)
 		}
+		tui.highlight(buf.String())
 	})
 }
 
@@ -264,10 +281,63 @@ func tuiHome(tui *tuiT, _ int) {
 	tui.refresh()
 }
 
+func tuiJump(tui *tuiT, _ int) {
+	if s := strings.TrimSpace(tui.prompt(": ")); !tui.G.Has(s) {
+		tui.Error(config.NewEntryError(config.ErrUnknownEntry, s,
+			"unknown entry: %s", s))
+	} else {
+		tui.jump(s)
+	}
+}
+
+func tuiPlatform(tui *tuiT, _ int) {
+	s := strings.TrimSpace(tui.prompt("GOOS/GOARCH: "))
+	if s == "" {
+		return
+	}
+	if p, err := config.ParsePlatform(s); err != nil {
+		tui.Error(err)
+	} else if err = tui.G.SetPlatform(p); err != nil {
+		tui.Error(err)
+	} else {
+		tui.Name = tui.G.Begin
+		tui.row = 0
+		tui.refresh()
+	}
+}
+
+// tuiQuit exits unless canceled while asked to save any changes.
+func tuiQuit(tui *tuiT, _ int) {
+	tui.done = tui.quit()
+}
+
+func tuiRedo(tui *tuiT, n int) {
+	ok := true
+	for i := 0; ok && i < n; i++ {
+		ok = tui.G.Redo()
+	}
+	tui.refresh()
+	if !ok {
+		tui.msg = "Nothing to redo."
+	}
+}
+
 func tuiRefresh(tui *tuiT, _ int) {
 	tui.refresh()
 }
 
+// tuiResize redraws the entries after a change of the terminal size.
+func tuiResize(tui *tuiT, _ int) {
+	if tui.row > tui.rows-2 {
+		tui.row = tui.rows - 2
+	}
+	if tui.row < 0 {
+		tui.row = 0
+	}
+	tui.refresh()
+	tui.details()
+}
+
 func tuiPageUp(tui *tuiT, _ int) {
 	tuiBackward(tui, tui.row)
 	tui.row = tui.rows - 2
@@ -276,7 +346,7 @@ func tuiPageUp(tui *tuiT, _ int) {
 		if !ok {
 			break
 		}
-		if name = e.prev; name == "" {
+		if name = e.Prev(); name == "" {
 			tui.Name = tui.G.Begin
 			tui.row = 0
 			break
@@ -295,27 +365,118 @@ func tuiReinit(tui *tuiT, n int) {
 	if n == 0 {
 		tui.G.Reinit()
 		tui.refresh()
-	} else if e, ok := tui.G.Entry[tui.Name]; ok {
-		e.Reinit()
-		tui.show(tui.Name, tui.row, NormalAttr)
+	} else if tui.G.Has(tui.Name) {
+		tui.G.Unset(tui.Name)
+		tui.show(tui.Name, tui.row, tui.theme.Normal)
 		tuiForward(tui, 1)
 	}
 }
 
+func tuiUndo(tui *tuiT, n int) {
+	ok := true
+	for i := 0; ok && i < n; i++ {
+		ok = tui.G.Undo()
+	}
+	tui.refresh()
+	if !ok {
+		tui.msg = "Nothing to undo."
+	}
+}
+
+func tuiSearch(tui *tuiT, _ int) {
+	re, err := compileSearch(tui.prompt("/"), tui.search)
+	if err != nil {
+		tui.Error(err)
+		return
+	}
+	tui.search, tui.reverse = re, false
+	tui.find(false)
+}
+
+// tuiSearchBackward is the '?' help key unless given a pattern.
+func tuiSearchBackward(tui *tuiT, n int) {
+	s := tui.prompt("?")
+	if s == "" {
+		tuiHelp(tui, n)
+		return
+	}
+	re, err := compileSearch(s, tui.search)
+	if err != nil {
+		tui.Error(err)
+		return
+	}
+	tui.search, tui.reverse = re, true
+	tui.find(true)
+}
+
+func tuiSearchNext(tui *tuiT, _ int) {
+	if tui.search == nil {
+		tui.Error(config.NewError(config.ErrUsage,
+			"no previous search pattern"))
+	} else {
+		tui.find(tui.reverse)
+	}
+}
+
+func tuiSearchPrev(tui *tuiT, _ int) {
+	if tui.search == nil {
+		tui.Error(config.NewError(config.ErrUsage,
+			"no previous search pattern"))
+	} else {
+		tui.find(!tui.reverse)
+	}
+}
+
+// tuiSet picks one of the entry's choices, edits multi-line text, or prompts
+// for a number or text, that must be valid.
 func tuiSet(tui *tuiT, _ int) {
-	var postXset bool
+	var s string
+	var ok, postXset, popup bool
 	name := tui.Name
-	tui.show(name, tui.row, EntryAttr)
-	if s := tui.prompt(": "); len(s) > 0 {
-		postXset = tui.G.Set(name, s)
+	e, found := tui.G.Entry[name]
+	if !found {
+		return
+	}
+	validate := func(s string) error {
+		return tui.G.Validate(name, s)
+	}
+	tui.show(name, tui.row, tui.theme.Entry)
+	switch v := e.Value.String(); {
+	case len(e.Choices) > 0:
+		s, ok = tui.pick(name, e.Choices, v)
+		ok, popup = ok && s != v, true
+	case e.Value.IsString() && strings.ContainsRune(v, '\n'):
+		s, ok = tui.edit(name, v, validate)
+		ok, popup = ok && s != v, true
+	case e.IsNumber():
+		s, ok = tui.input(": ", v, isNumberRune, validate)
+		ok = ok && s != v
+	default:
+		s, ok = tui.input(": ", "", nil, validate)
+		ok = ok && len(s) > 0
 	}
-	tui.show(tui.Name, tui.row, NormalAttr)
+	if ok {
+		postXset = tui.G.Set(config.OriginUser, name, s)
+	}
+	tui.show(tui.Name, tui.row, tui.theme.Normal)
 	tuiForward(tui, 1)
-	if postXset {
+	if postXset || popup {
 		tui.refresh()
 	}
 }
 
+// tuiSplit toggles the details panel.
+func tuiSplit(tui *tuiT, _ int) {
+	tui.split = !tui.split
+	tui.refresh()
+	if tui.split && tui.listWidth() == tui.cols {
+		tui.msg = "The terminal is too narrow for details."
+	}
+}
+
+func tuiWheelUp(tui *tuiT, _ int)   { tuiBackward(tui, 3) }
+func tuiWheelDown(tui *tuiT, _ int) { tuiForward(tui, 3) }
+
 func tuiStore(tui *tuiT, _ int) {
 	if err := tui.G.Store(); err != nil {
 		tui.Error(err)
@@ -329,11 +490,13 @@ func tuiToggle(tui *tuiT, _ int) {
 		if v := e.Value; v != nil {
 			var refresh bool
 			if v.IsTrue() {
-				refresh = tui.G.Set(tui.Name, "false")
+				refresh = tui.G.Set(config.OriginUser, tui.Name,
+					"false")
 			} else if v.IsFalse() {
-				refresh = tui.G.Set(tui.Name, "true")
+				refresh = tui.G.Set(config.OriginUser, tui.Name,
+					"true")
 			}
-			tui.show(tui.Name, tui.row, EntryAttr)
+			tui.show(tui.Name, tui.row, tui.theme.Entry)
 			if refresh {
 				tui.refresh()
 			}
@@ -343,23 +506,53 @@ func tuiToggle(tui *tuiT, _ int) {
 
 func (tui *tuiT) anyKey() {
 	tui.status("Press any key to continue.")
-	_ = tui.scr.GetChar()
+	_ = tui.key()
 	tui.scr.Move(tui.rows-1, 0)
 	tui.scr.ClearToEOL()
-	tui.scr.NoutRefresh()
-	goncurses.Update()
+	tui.scr.Update()
 }
 
 func (tui *tuiT) Error(err error) {
 	tui.msg = "error: " + err.Error()
 }
 
+func (tui *tuiT) find(backward bool) {
+	if s := tui.G.Find(tui.search, tui.Name, backward); s == "" {
+		tui.Error(config.NewError(config.ErrNotFound,
+			"pattern not found: %s", tui.search))
+	} else {
+		tui.jump(s)
+	}
+}
+
+// highlight writes the text with the matches of the last search standing out.
+func (tui *tuiT) highlight(s string) {
+	if tui.search == nil {
+		fmt.Fprint(tui, s)
+		return
+	}
+	for _, line := range strings.SplitAfter(s, "\n") {
+		i := 0
+		for _, x := range tui.search.FindAllStringIndex(line, -1) {
+			if x[0] == x[1] {
+				continue
+			}
+			fmt.Fprint(tui, line[i:x[0]])
+			tui.scr.AttrOn(tui.theme.Match)
+			fmt.Fprint(tui, line[x[0]:x[1]])
+			tui.scr.AttrOff(tui.theme.Match)
+			i = x[1]
+		}
+		fmt.Fprint(tui, line[i:])
+	}
+}
+
 func (tui *tuiT) init() (err error) {
-	if tui.scr, err = goncurses.Init(); err != nil {
+	if tui.scr, err = openScreen(); err != nil {
 		return
 	}
-	tui.rows, tui.cols = tui.scr.MaxYX()
-	tui.scr.Keypad(true)
+	tui.rows, tui.cols = tui.scr.Size()
+	tui.theme = tuiTheme()
 	if tui.G.IsList() {
 		tui.command = tuiPkgCommands
 		tui.help = tuiPkgHelp
@@ -374,6 +567,45 @@ func (tui *tuiT) init() (err error) {
 	return
 }
 
+// tuiCommands returns the map of the bound keys to the functions of the
+// actions along with the fixed resize and mouse events.
+func tuiCommands(actions map[string]func(*tuiT, int)) map[rune]func(*tuiT, int) {
+	m := map[rune]func(*tuiT, int){
+		keyResize:    tuiResize,
+		keyMouse:     tuiClick,
+		keyWheelUp:   tuiWheelUp,
+		keyWheelDown: tuiWheelDown,
+	}
+	for _, a := range keyActions {
+		if f, ok := actions[a.name]; ok {
+			for _, r := range a.keys {
+				m[r] = f
+			}
+		}
+	}
+	return m
+}
+
+// key returns the next key, taking the new size of the screen on keyResize.
+func (tui *tuiT) key() rune {
+	r := tui.scr.GetKey()
+	if r == keyResize {
+		tui.rows, tui.cols = tui.scr.Size()
+	}
+	return r
+}
+
+// jump to the named entry keeping its row if there are enough entries before
+// it to fill the screen above.
+func (tui *tuiT) jump(name string) {
+	i := 0
+	for s := tui.G.Entry[name].Prev(); s != "" && i < tui.row; i++ {
+		s = tui.G.Entry[s].Prev()
+	}
+	tui.Name, tui.row = name, i
+	tui.refresh()
+}
+
 func (tui *tuiT) Marshal() string {
 	return tui.G.Marshal(tui.Name)
 }
@@ -389,85 +621,99 @@ func (tui *tuiT) popup(f func(...interface{}), args ...interface{}) {
 	tui.refresh()
 }
 
+// prompt returns the text entered on the status line or "" if canceled.
 func (tui *tuiT) prompt(a ...interface{}) string {
-	var err error
-	s := fmt.Sprint(a...)
-	n := tui.cols - len(s)
-	tui.status(s)
-	goncurses.Cursor(1)
-	goncurses.Echo(true)
-	s, err = tui.scr.GetString(n)
-	goncurses.Cursor(0)
-	goncurses.Echo(false)
-	if err == nil {
-		return s
+	s, _ := tui.input(fmt.Sprint(a...), "", nil, nil)
+	return s
+}
+
+// quit returns true after reviewing any pending changes and asking whether to
+// save them; the answer may also cancel the exit.
+func (tui *tuiT) quit() bool {
+	if tui.G.IsList() || !tui.G.Dirty() {
+		return true
 	}
-	return ""
+	row := tui.row
+	tui.row = 0
+	tui.scr.Move(tui.row, 0)
+	tui.scr.Clear()
+	fmt.Fprint(tui, tui.G.Diff())
+	s := strings.TrimSpace(tui.prompt("save changes? (y/n/c) "))
+	tui.row = row
+	switch s {
+	case "y", "Y":
+		if err := tui.G.Store(); err != nil {
+			tui.refresh()
+			tui.Error(err)
+			return false
+		}
+	case "n", "N":
+	default:
+		tui.refresh()
+		return false
+	}
+	return true
 }
 
 func (tui *tuiT) refresh() {
 	tui.scr.Move(0, 0)
 	tui.scr.Clear()
 	for i, name := tui.row, tui.Name; name != "" && i >= 0; i -= 1 {
-		tui.show(name, i, NormalAttr)
-		name = tui.G.Entry[name].prev
+		tui.show(name, i, tui.theme.Normal)
+		name = tui.G.Entry[name].Prev()
 	}
 	for i, name := tui.row, tui.Name; name != "" && i < tui.rows-1; i += 1 {
-		tui.show(name, i, NormalAttr)
-		if name = tui.G.Entry[name].next; name == "" {
+		tui.show(name, i, tui.theme.Normal)
+		if name = tui.G.Entry[name].Next(); name == "" {
 			break
 		}
 	}
-	tui.msg = "goconfig " + tui.G.Package + "; press ? for help."
+	tui.msg = "goconfig " + tui.G.Package + " " +
+		tui.G.Platform.String() + "; press ? for help."
 }
 
-func (tui *tuiT) showEntry(name string, row int, attr goncurses.Char) {
+func (tui *tuiT) showEntry(name string, row int, attr int) {
 	const sep = ": "
 	const ellipsis = "..."
 	e, ok := tui.G.Entry[name]
 	if !ok {
 		return
 	}
-	val := e.Value.YAML()
-	if nl := strings.IndexAny(val, "\n\r"); nl >= 0 {
-		val = val[:nl] + "..."
+	val := oneLine(e.Value.YAML())
+	if attr == tui.theme.Normal && e.Init != nil && !e.Value.Equal(e.Init) {
+		attr = tui.theme.Modified
 	}
-	max := tui.cols - len(name) - len(sep)
-	if len(val) > max {
+	width := tui.listWidth()
+	max := width - len(name) - len(sep)
+	if max < len(ellipsis) {
+		val = ""
+	} else if len(val) > max {
 		val = val[:max-len(ellipsis)] + ellipsis
 	}
 	tui.scr.Move(row, 0)
-	tui.scr.ClearToEOL()
-	if attr != NormalAttr {
-		tui.scr.Print(name, sep)
-		tui.scr.AttrOn(attr)
-		tui.scr.Print(val)
-		tui.scr.AttrOff(attr)
-	} else {
-		tui.scr.Print(name, sep, val)
-	}
+	tui.scr.Print(fit(name+sep, width, ' '))
+	tui.scr.Move(row, len(name)+len(sep))
+	tui.scr.AttrOn(attr)
+	tui.scr.Print(val)
+	tui.scr.AttrOff(attr)
 }
 
-func (tui *tuiT) showPkg(name string, row int, attr goncurses.Char) {
+func (tui *tuiT) showPkg(name string, row int, attr int) {
 	tui.scr.Move(row, 0)
-	tui.scr.ClearToEOL()
-	if attr != NormalAttr {
-		tui.scr.AttrOn(attr)
-		tui.scr.Print(name)
-		tui.scr.AttrOff(attr)
-	} else {
-		tui.scr.Print(name)
-	}
+	tui.scr.Print(fit("", tui.listWidth(), ' '))
+	tui.scr.Move(row, 0)
+	tui.scr.AttrOn(attr)
+	tui.scr.Print(name)
+	tui.scr.AttrOff(attr)
 }
 
 func (tui *tuiT) status(a ...interface{}) {
 	tui.scr.Move(tui.rows-1, 0)
 	tui.scr.ClearToEOL()
-	tui.scr.AttrOn(StatusAttr)
+	tui.scr.AttrOn(tui.theme.Status)
 	tui.scr.Print(a...)
-	tui.scr.AttrOff(StatusAttr)
-	tui.scr.NoutRefresh()
-	goncurses.Update()
+	tui.scr.AttrOff(tui.theme.Status)
+	tui.scr.Update()
 }
 
 // This is a primitive pager for the Help and Exec output.
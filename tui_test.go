@@ -0,0 +1,294 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !noTUI
+
+package main
+
+import (
+	"errors"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// memScreenT is a screen in memory for tests of the TUI.  GetKey returns the
+// scripted keys then panics with errEndOfKeys so that tests may snapshot the
+// screen wherever the script leaves it.
+type memScreenT struct {
+	*screenT
+	keys []keyT
+}
+
+var errEndOfKeys = errors.New("end of scripted keys")
+
+func newMemScreen(rows, cols int, keys ...keyT) *memScreenT {
+	scr := &memScreenT{screenT: new(screenT), keys: keys}
+	scr.resize(rows, cols)
+	return scr
+}
+
+func (scr *memScreenT) End() error { return nil }
+func (scr *memScreenT) Update()    {}
+
+// GetKey resizes the screen for keyResize events to their row and column;
+// keyMouse events are clicks at theirs.
+func (scr *memScreenT) GetKey() rune {
+	if len(scr.keys) == 0 {
+		panic(errEndOfKeys)
+	}
+	k := scr.keys[0]
+	scr.keys = scr.keys[1:]
+	switch k.r {
+	case keyResize:
+		scr.resize(k.row, k.col)
+	case keyMouse:
+		scr.mouse = k
+	}
+	return k.r
+}
+
+// String returns the lines of the screen without trailing blanks.
+func (scr *memScreenT) String() string {
+	lines := make([]string, len(scr.cells))
+	for i, line := range scr.cells {
+		r := make([]rune, len(line))
+		for j, c := range line {
+			r[j] = c.r
+		}
+		lines[i] = strings.TrimRight(string(r), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// line returns the text of the row.
+func (scr *memScreenT) line(row int) string {
+	return strings.Split(scr.String(), "\n")[row]
+}
+
+// attrAt returns the attributes of the cell.
+func (scr *memScreenT) attrAt(row, col int) int {
+	return scr.cells[row][col].attr
+}
+
+// typed returns the keys of the text.
+func typed(s string) []keyT {
+	var keys []keyT
+	for _, r := range s {
+		keys = append(keys, keyT{r: r})
+	}
+	return keys
+}
+
+// runTUI runs the TUI of the package on the screen until the end of its keys
+// with the default key bindings and theme.
+func runTUI(t *testing.T, pkg string, scr *memScreenT) (g *config.GoConfig) {
+	g, err := config.NewGoConfig(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "goconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := []string{os.Getenv("XDG_CONFIG_HOME"), os.Getenv("NO_COLOR"),
+		os.Getenv("GOCONFIG_THEME")}
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	os.Setenv("NO_COLOR", "")
+	os.Setenv("GOCONFIG_THEME", "")
+	savedOpen := openScreen
+	openScreen = func() (screen, error) { return scr, nil }
+	defer func() {
+		openScreen = savedOpen
+		os.Setenv("XDG_CONFIG_HOME", saved[0])
+		os.Setenv("NO_COLOR", saved[1])
+		os.Setenv("GOCONFIG_THEME", saved[2])
+		if r := recover(); r != nil && r != errEndOfKeys {
+			panic(r)
+		}
+	}()
+	if err = __tui__(g); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func wantLines(t *testing.T, scr *memScreenT, want ...string) {
+	for row, s := range want {
+		if got := scr.line(row); got != s {
+			t.Errorf("row %d: got %q, want %q\n%s", row, got, s, scr)
+		}
+	}
+}
+
+func TestTUIScroll(t *testing.T) {
+	scr := newMemScreen(5, 40, typed("jjjjjj")...)
+	runTUI(t, "./examples/long", scr)
+	wantLines(t, scr,
+		"main.s003: \"\"",
+		"main.s004: \"\"",
+		"main.s005: \"\"",
+		"main.s006: \"\"")
+	scr = newMemScreen(5, 40, typed("jjjjjjkkkkk")...)
+	runTUI(t, "./examples/long", scr)
+	wantLines(t, scr,
+		"main.s001: \"\"",
+		"main.s002: \"\"",
+		"main.s003: \"\"",
+		"main.s004: \"\"")
+}
+
+func TestTUIPage(t *testing.T) {
+	scr := newMemScreen(5, 40, keyT{r: keyPageDown}, keyT{r: keyPageDown})
+	runTUI(t, "./examples/long", scr)
+	wantLines(t, scr,
+		"main.s004: \"\"",
+		"main.s005: \"\"",
+		"main.s006: \"\"",
+		"main.s007: \"\"")
+	scr = newMemScreen(5, 40, keyT{r: keyEnd}, keyT{r: keyPageUp})
+	runTUI(t, "./examples/long", scr)
+	wantLines(t, scr,
+		"main.s193: \"\"",
+		"main.s194: \"\"",
+		"main.s195: \"\"",
+		"main.s196: \"\"")
+	scr = newMemScreen(5, 40, keyT{r: keyEnd}, keyT{r: keyHome})
+	runTUI(t, "./examples/long", scr)
+	wantLines(t, scr, "main.s000: \"\"")
+	if attr := scr.attrAt(0, len(`main.s000: `)); attr != attrStandout {
+		t.Errorf("selected entry attributes: %#x", attr)
+	}
+}
+
+func TestTUISetRefresh(t *testing.T) {
+	scr := newMemScreen(5, 40, typed("j ")...)
+	g := runTUI(t, "./examples/exclusive", scr)
+	wantLines(t, scr,
+		"t1: false",
+		"t2: true",
+		"t3: false")
+	if !g.Entry["t2"].Value.IsTrue() {
+		t.Error("t2 isn't set")
+	}
+	scr = newMemScreen(5, 40, append(typed("j "),
+		keyT{r: ctrlR}, keyT{r: ctrlZ})...)
+	runTUI(t, "./examples/exclusive", scr)
+	wantLines(t, scr,
+		"t1: false",
+		"t2: true",
+		"t3: false")
+}
+
+func TestTUIModified(t *testing.T) {
+	scr := newMemScreen(5, 40, typed("j k")...)
+	runTUI(t, "./examples/exclusive", scr)
+	col := len("t1: ")
+	if attr := scr.attrAt(1, col); attr != themes["default"].Modified {
+		t.Errorf("modified t2 attributes: %#x", attr)
+	}
+	if attr := scr.attrAt(2, col); attr != attrNormal {
+		t.Errorf("t3 attributes: %#x", attr)
+	}
+}
+
+func TestTUIPopup(t *testing.T) {
+	scr := newMemScreen(10, 60, keyT{r: keyF1})
+	runTUI(t, "./examples/exclusive", scr)
+	wantLines(t, scr, "goconfig keys:")
+	if s := scr.line(9); s != "Press any key to continue." {
+		t.Errorf("status: %q", s)
+	}
+	scr = newMemScreen(10, 60, keyT{r: keyF1}, keyT{r: 'x'},
+		keyT{r: 'x'}, keyT{r: 'x'}, keyT{r: 'x'}, keyT{r: 'x'},
+		keyT{r: 'x'}, keyT{r: 'x'}, keyT{r: 'x'}, keyT{r: 'x'},
+		keyT{r: 'x'})
+	runTUI(t, "./examples/exclusive", scr)
+	wantLines(t, scr, "t1: true", "t2: false", "t3: false")
+}
+
+func TestTUIResize(t *testing.T) {
+	scr := newMemScreen(10, 40, append(typed("jjjjjjjj"),
+		keyT{keyResize, 4, 30})...)
+	runTUI(t, "./examples/long", scr)
+	wantLines(t, scr,
+		"main.s006: \"\"",
+		"main.s007: \"\"",
+		"main.s008: \"\"")
+	scr = newMemScreen(0, 0)
+	scr.Print("x\n")
+	scr.Scroll(1)
+	scr.Scroll(-1)
+	if rows, cols := scr.Size(); rows != 1 || cols != 1 {
+		t.Errorf("size: %dx%d", rows, cols)
+	}
+}
+
+// TestTUIPick scrolls to the last choice then, after a resize, shows all.
+func TestTUIPick(t *testing.T) {
+	scr := newMemScreen(5, 40, typed("\rjj")...)
+	runTUI(t, "./examples/typed", scr)
+	wantLines(t, scr,
+		"main.color: r┌─ main.color┐",
+		"main.count: 1│ green      │",
+		"main.greeting│ blue       │")
+	scr = newMemScreen(5, 40, append(typed("\rjj"),
+		keyT{keyResize, 10, 40})...)
+	runTUI(t, "./examples/typed", scr)
+	wantLines(t, scr,
+		"main.color: red",
+		"main.count: 1",
+		"main.greeting┌─ main.color┐",
+		"             │ red        │",
+		"             │ green      │",
+		"             │ blue       │")
+}
+
+func TestLoadKeys(t *testing.T) {
+	saved := make([][]rune, len(keyActions))
+	for i, a := range keyActions {
+		saved[i] = append([]rune(nil), a.keys...)
+	}
+	defer func() {
+		for i, a := range keyActions {
+			a.keys = saved[i]
+		}
+	}()
+	f, err := ioutil.TempFile("", "keys.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("search-next: N\nsearch-prev: n\n")
+	f.Close()
+	err = loadKeys(f.Name())
+	if err == nil || !strings.Contains(err.Error(), "quote single-letter") {
+		t.Errorf("unquoted: %v", err)
+	}
+	ioutil.WriteFile(f.Name(),
+		[]byte(`search-next: "N"`+"\n"+`search-prev: ["n"]`+"\n"), 0644)
+	if err = loadKeys(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if a := keyAction("search-next"); len(a.keys) != 1 || a.keys[0] != 'N' {
+		t.Errorf("search-next: %q", a.keys)
+	}
+}
+
+func TestTUIMouse(t *testing.T) {
+	scr := newMemScreen(5, 40, keyT{keyMouse, 2, 0}, keyT{keyMouse, 2, 0})
+	g := runTUI(t, "./examples/exclusive", scr)
+	if !g.Entry["t3"].Value.IsTrue() {
+		t.Errorf("t3 isn't toggled\n%s", scr)
+	}
+	scr = newMemScreen(5, 40, keyT{r: keyWheelDown})
+	runTUI(t, "./examples/long", scr)
+	wantLines(t, scr, "main.s000: \"\"")
+	if attr := scr.attrAt(3, len(`main.s003: `)); attr != attrStandout {
+		t.Errorf("wheel didn't select main.s003\n%s", scr)
+	}
+}
@@ -0,0 +1,485 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The REST API of the webserver has these JSON resources below the prefix of
+// its WebHandler, /goconfig/ by default,
+//
+//	GET	api/v1/packages
+//	GET	api/v1/packages/{pkg}
+//	GET	api/v1/packages/{pkg}/entries
+//	PATCH	api/v1/packages/{pkg}/entries		{"name": value, ...}
+//	GET	api/v1/packages/{pkg}/entries/{name}
+//	PUT	api/v1/packages/{pkg}/entries/{name}	{"value": value}
+//	POST	api/v1/packages/{pkg}/save
+//	POST	api/v1/packages/{pkg}/reinit		[{"names": [name, ...]}]
+//	POST	api/v1/packages/{pkg}/go		{"args": [arg, ...]}
+//	GET	api/v1/packages/{pkg}/events
+//
+// Responses about a package have its version as the ETag; requests that
+// change it may have an If-Match header with the version of the client's
+// copy to fail with 412 Precondition Failed, rather than overwrite, if another
+// client first changed the entries to set, or any entry to reinitialize all.
+// Requests other than GET must be application/json, which other sites can't
+// forge; those of a read-only server may only run the allowed go commands.
+// Errors are the JSON objects of WriteJSONError.
+//
+// The events resource is a stream of server-sent events: "change" and
+// "reinit" with the version and changed entries; "save" with the
+// configuration file; and "platform", after which clients should reload.
+const apiPath = "api/v1/"
+
+// apiMaxBody is the limit of request bodies.
+const apiMaxBody = 1 << 20
+
+type apiT struct {
+	h   *WebHandler
+	w   http.ResponseWriter
+	r   *http.Request
+	wsg *wsgT
+}
+
+// apiEntryT is the JSON form of an entry and its value.
+type apiEntryT struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"`
+	Value    interface{} `json:"value"`
+	Init     interface{} `json:"init"`
+	Modified bool        `json:"modified"`
+	Help     string      `json:"help,omitempty"`
+	Choices  []string    `json:"choices,omitempty"`
+}
+
+type apiEntriesT struct {
+	Version int          `json:"version"`
+	Entries []*apiEntryT `json:"entries"`
+}
+
+type apiPackageT struct {
+	Package       string `json:"package"`
+	Platform      string `json:"platform"`
+	Configuration string `json:"configuration"`
+	Version       int    `json:"version"`
+	Dirty         bool   `json:"dirty"`
+}
+
+func (h *WebHandler) apiHandler(w http.ResponseWriter, r *http.Request) {
+	api := &apiT{h: h, w: w, r: r}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, apiMaxBody)
+	}
+	path := strings.TrimPrefix(r.URL.Path, h.api)
+	if path == "packages" {
+		api.packages()
+		return
+	}
+	if !strings.HasPrefix(path, "packages/") {
+		api.fail(http.StatusNotFound, config.NewError(
+			config.ErrNotFound, "not found: %s", r.URL.Path))
+		return
+	}
+	pkg, resource, name := apiRoute(strings.TrimPrefix(path, "packages/"))
+	var err error
+	if api.wsg, err = h.wsgFor(pkg); err != nil {
+		api.fail(apiStatus(err), err)
+		return
+	}
+	if api.wsg.G.IsList() {
+		api.fail(http.StatusNotFound, config.NewError(
+			config.ErrNotFound, "not found: %s", r.URL.Path))
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		if h.auth.forgedAPI(r) {
+			err = config.NewError(config.ErrUsage,
+				"the Content-Type must be application/json")
+			api.fail(http.StatusUnsupportedMediaType, err)
+			return
+		}
+		if h.auth.ReadOnly && resource != "go" {
+			api.fail(http.StatusForbidden, config.NewError(
+				config.ErrForbidden, "read-only"))
+			return
+		}
+	}
+	if resource == "events" {
+		if api.allow("GET") {
+			api.events()
+		}
+		return
+	}
+	api.wsg.mutex.Lock()
+	defer api.wsg.mutex.Unlock()
+	switch resource {
+	case "":
+		if api.allow("GET") {
+			api.pkg()
+		}
+	case "entries":
+		if name != "" {
+			if api.allow("GET", "PUT") {
+				api.entry(name)
+			}
+		} else if api.allow("GET", "PATCH") {
+			api.entries()
+		}
+	case "save":
+		if api.allow("POST") {
+			api.save()
+		}
+	case "reinit":
+		if api.allow("POST") {
+			api.reinit()
+		}
+	case "go":
+		if api.allow("POST") {
+			api.gotool()
+		}
+	}
+}
+
+// apiRoute splits the path after "packages/" into the package, which may
+// have slashes, and the named resource and entry.
+func apiRoute(path string) (pkg, resource, name string) {
+	if i := strings.LastIndex(path, "/entries/"); i > 0 {
+		return path[:i], "entries", path[i+len("/entries/"):]
+	}
+	for _, s := range []string{"entries", "save", "reinit", "go",
+		"events"} {
+		if strings.HasSuffix(path, "/"+s) {
+			return strings.TrimSuffix(path, "/"+s), s, ""
+		}
+	}
+	return path, "", ""
+}
+
+// apiStatus returns the HTTP status of the error code.
+func apiStatus(err error) int {
+	if e, ok := err.(*config.Error); ok {
+		switch e.Code {
+		case config.ErrNotFound, config.ErrUnknownEntry:
+			return http.StatusNotFound
+		case config.ErrInvalidValue:
+			return http.StatusUnprocessableEntity
+		case config.ErrSyntax, config.ErrUsage:
+			return http.StatusBadRequest
+		case config.ErrConflict:
+			return http.StatusPreconditionFailed
+		case config.ErrUnauthorized:
+			return http.StatusUnauthorized
+		case config.ErrForbidden:
+			return http.StatusForbidden
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// allow returns true if the request method is one of those given; otherwise,
+// this fails with 405 Method Not Allowed.
+func (api *apiT) allow(methods ...string) bool {
+	for _, m := range methods {
+		if api.r.Method == m || (m == "GET" && api.r.Method == "HEAD") {
+			return true
+		}
+	}
+	api.w.Header().Set("Allow", strings.Join(methods, ", "))
+	api.fail(http.StatusMethodNotAllowed, config.NewError(config.ErrUsage,
+		"method not allowed: %s", api.r.Method))
+	return false
+}
+
+// decode the JSON request body; an empty body leaves v unchanged.
+func (api *apiT) decode(v interface{}) error {
+	if api.r.Body == nil {
+		return nil
+	}
+	d := json.NewDecoder(api.r.Body)
+	d.UseNumber()
+	if err := d.Decode(v); err != nil && err != io.EOF {
+		return config.NewError(config.ErrSyntax,
+			"invalid request body: %v", err)
+	}
+	return nil
+}
+
+func (api *apiT) etag() string {
+	return `"` + strconv.Itoa(api.wsg.Version) + `"`
+}
+
+// match returns true unless the If-Match header has neither "*" nor a
+// version after which the named entries, or without names, any entry
+// changed; otherwise, this fails with 412 Precondition Failed.
+func (api *apiT) match(names ...string) bool {
+	s := api.r.Header.Get("If-Match")
+	if s == "" {
+		return true
+	}
+	etag := api.etag()
+	for _, x := range strings.Split(s, ",") {
+		x = strings.TrimPrefix(strings.TrimSpace(x), "W/")
+		if x == "*" || x == etag {
+			return true
+		}
+		v, err := strconv.Atoi(strings.Trim(x, `"`))
+		if err == nil && !api.wsg.changedSince(v, names...) {
+			return true
+		}
+	}
+	api.w.Header().Set("ETag", etag)
+	api.fail(http.StatusPreconditionFailed, config.NewError(
+		config.ErrConflict, "%s changed; its version is now %d",
+		api.wsg.G.Package, api.wsg.Version))
+	return false
+}
+
+func (api *apiT) fail(status int, err error) {
+	api.w.Header().Set("Content-Type", "application/json")
+	api.w.WriteHeader(status)
+	config.WriteJSONError(api.w, err)
+}
+
+func (api *apiT) reply(status int, v interface{}) {
+	api.w.Header().Set("Content-Type", "application/json")
+	if api.wsg != nil {
+		api.w.Header().Set("ETag", api.etag())
+	}
+	api.w.WriteHeader(status)
+	if api.r.Method != "HEAD" {
+		json.NewEncoder(api.w).Encode(v)
+	}
+}
+
+func (api *apiT) packages() {
+	if !api.allow("GET") {
+		return
+	}
+	var err error
+	if api.wsg, err = api.h.wsgFor(config.ALL); err != nil {
+		api.fail(apiStatus(err), err)
+		return
+	}
+	api.wsg.mutex.Lock()
+	defer api.wsg.mutex.Unlock()
+	a := make([]string, 0, len(api.wsg.G.Entries))
+	for _, e := range api.wsg.G.Entries {
+		a = append(a, e.Name)
+	}
+	api.reply(http.StatusOK, struct {
+		Packages []string `json:"packages"`
+	}{a})
+}
+
+func (api *apiT) pkg() {
+	g := api.wsg.G
+	api.reply(http.StatusOK, &apiPackageT{
+		Package:       g.Package,
+		Platform:      g.Platform.String(),
+		Configuration: g.GoConfiguration,
+		Version:       api.wsg.Version,
+		Dirty:         g.Dirty(),
+	})
+}
+
+func (api *apiT) entries() {
+	if api.r.Method == "PATCH" {
+		m := make(map[string]interface{})
+		if err := api.decode(&m); err != nil {
+			api.fail(apiStatus(err), err)
+			return
+		}
+		texts := make(map[string]string, len(m))
+		names := make([]string, 0, len(m))
+		for name, v := range m {
+			s, err := api.text(name, v)
+			if err != nil {
+				api.fail(apiStatus(err), err)
+				return
+			}
+			texts[name] = s
+			names = append(names, name)
+		}
+		if len(names) == 0 || !api.match(names...) {
+			if len(names) == 0 {
+				api.replyEntries()
+			}
+			return
+		}
+		api.wsg.update("change", func() {
+			for _, e := range api.wsg.G.Entries {
+				if s, ok := texts[e.Name]; ok {
+					api.wsg.G.Set(config.OriginUser,
+						e.Name, s)
+				}
+			}
+		})
+	}
+	api.replyEntries()
+}
+
+func (api *apiT) replyEntries() {
+	x := &apiEntriesT{Version: api.wsg.Version,
+		Entries: make([]*apiEntryT, 0, len(api.wsg.G.Entries))}
+	for _, e := range api.wsg.G.Entries {
+		x.Entries = append(x.Entries, newAPIEntry(e))
+	}
+	api.reply(http.StatusOK, x)
+}
+
+func (api *apiT) entry(name string) {
+	e, ok := api.wsg.G.Entry[name]
+	if !ok {
+		api.fail(http.StatusNotFound, config.NewEntryError(
+			config.ErrUnknownEntry, name, "unknown entry: %s",
+			name))
+		return
+	}
+	if api.r.Method == "PUT" {
+		if !api.match(name) {
+			return
+		}
+		var body struct {
+			Value interface{} `json:"value"`
+		}
+		if err := api.decode(&body); err != nil {
+			api.fail(apiStatus(err), err)
+			return
+		}
+		s, err := api.text(name, body.Value)
+		if err != nil {
+			api.fail(apiStatus(err), err)
+			return
+		}
+		api.wsg.update("change", func() {
+			api.wsg.G.Set(config.OriginUser, name, s)
+		})
+	}
+	api.reply(http.StatusOK, newAPIEntry(e))
+}
+
+// text returns the validated Set text of the JSON value; strings are quoted
+// so that those like "true" and "nil" stay strings.
+func (api *apiT) text(name string, v interface{}) (string, error) {
+	e, ok := api.wsg.G.Entry[name]
+	if !ok {
+		return "", config.NewEntryError(config.ErrUnknownEntry, name,
+			"unknown entry: %s", name)
+	}
+	var s string
+	switch t := v.(type) {
+	case nil:
+	case string:
+		s = t
+		if !e.Value.IsTag() && s != "" {
+			s = `"` + s + `"`
+		}
+	case bool, json.Number:
+		s = fmt.Sprint(t)
+	default:
+		return "", config.NewEntryError(config.ErrInvalidValue, name,
+			"%s: invalid value: %v", name, t)
+	}
+	if err := api.wsg.G.Validate(name, s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+func (api *apiT) save() {
+	if err := api.wsg.G.Store(); err != nil {
+		api.fail(http.StatusInternalServerError, err)
+		return
+	}
+	api.wsg.saved()
+	api.reply(http.StatusOK, struct {
+		Configuration string `json:"configuration"`
+	}{api.wsg.G.GoConfiguration})
+}
+
+func (api *apiT) reinit() {
+	var body struct {
+		Names []string `json:"names"`
+	}
+	if err := api.decode(&body); err != nil {
+		api.fail(apiStatus(err), err)
+		return
+	}
+	for _, name := range body.Names {
+		if !api.wsg.G.Has(name) {
+			api.fail(http.StatusNotFound, config.NewEntryError(
+				config.ErrUnknownEntry, name,
+				"unknown entry: %s", name))
+			return
+		}
+	}
+	if !api.match(body.Names...) {
+		return
+	}
+	api.wsg.update("reinit", func() {
+		if len(body.Names) == 0 {
+			api.wsg.G.Reinit()
+		}
+		for _, name := range body.Names {
+			api.wsg.G.Unset(name)
+		}
+	})
+	api.replyEntries()
+}
+
+// gotool runs the go command with the goconfigured flags; a failed command
+// is the error of a successful response with its output.
+func (api *apiT) gotool() {
+	var body struct {
+		Args []string `json:"args"`
+	}
+	if err := api.decode(&body); err != nil {
+		api.fail(apiStatus(err), err)
+		return
+	}
+	if len(body.Args) == 0 {
+		err := config.NewError(config.ErrUsage, "go: missing command")
+		api.fail(apiStatus(err), err)
+		return
+	}
+	if err := api.h.auth.goAllowed(body.Args); err != nil {
+		api.fail(apiStatus(err), err)
+		return
+	}
+	x := struct {
+		Output string        `json:"output"`
+		Error  *config.Error `json:"error,omitempty"`
+	}{}
+	b, err := api.wsg.G.Run(append([]string{"go"}, body.Args...))
+	x.Output = string(b)
+	if err != nil {
+		x.Error = config.NewError(config.ErrCommand, "%v", err)
+	}
+	api.reply(http.StatusOK, &x)
+}
+
+func newAPIEntry(e *config.Entry) *apiEntryT {
+	x := &apiEntryT{
+		Name:     e.Name,
+		Type:     "string",
+		Value:    e.Value.Interface(),
+		Init:     e.Init.Interface(),
+		Modified: e.Init != nil && !e.Value.Equal(e.Init),
+		Help:     e.Help,
+		Choices:  e.Choices,
+	}
+	if e.Value.IsTag() {
+		x.Type = "bool"
+	}
+	return x
+}
@@ -0,0 +1,314 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the tests in the parent directory, that of the examples.
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func apiTest(t *testing.T, h *WebHandler, method, path, ifMatch, body string,
+	status int, want string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, h.api+path, strings.NewReader(body))
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	if method != "GET" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != status {
+		t.Errorf("%s %s: status %d, want %d\n%s", method, path, w.Code,
+			status, w.Body)
+	} else if got := w.Body.String(); !strings.Contains(got, want) {
+		t.Errorf("%s %s: got %s, want %s", method, path, got, want)
+	}
+	return w
+}
+
+func newTestHandler(t *testing.T, ws *WebServer) *WebHandler {
+	h, err := NewWebHandler(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestAPI(t *testing.T) {
+	h := newTestHandler(t, &WebServer{Prefix: "/dashboard/goconfig"})
+	const pkg = "packages/examples/simple"
+	w := apiTest(t, h, "GET", pkg+"/entries", "", "", http.StatusOK,
+		`{"name":"t1","type":"bool","value":false,"init":false,`+
+			`"modified":false}`)
+	if etag := w.Header().Get("ETag"); etag != `"0"` {
+		t.Errorf("ETag: %s", etag)
+	}
+	apiTest(t, h, "GET", pkg+"/entries/main.s1", "", "", http.StatusOK,
+		`"value":"The quick brown fox"`)
+	apiTest(t, h, "GET", pkg+"/entries/nosuch", "", "", http.StatusNotFound,
+		`{"error":{"code":"unknown-entry","message":"unknown entry: nosuch",`+
+			`"entry":"nosuch"}}`)
+	apiTest(t, h, "PUT", pkg+"/entries/main.s1", `"0"`, `{"value":"true"}`,
+		http.StatusOK, `"value":"true","init":"The quick brown fox",`+
+			`"modified":true`)
+	apiTest(t, h, "PATCH", pkg+"/entries", `"0"`, `{"main.s1":"x"}`,
+		http.StatusPreconditionFailed, `"code":"conflict"`)
+	w = apiTest(t, h, "PATCH", pkg+"/entries", `"0"`,
+		`{"t1":true,"main.s2":"nil"}`, http.StatusOK, `"version":2`)
+	if etag := w.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("ETag: %s", etag)
+	}
+	apiTest(t, h, "PATCH", pkg+"/entries", "", `{"t1":"maybe"}`,
+		http.StatusUnprocessableEntity, `"code":"invalid-value"`)
+	apiTest(t, h, "PATCH", pkg+"/entries", "", `{"t1":`,
+		http.StatusBadRequest, `"code":"syntax"`)
+	apiTest(t, h, "POST", pkg+"/reinit", "*", `{"names":["main.s1"]}`,
+		http.StatusOK, `"value":"The quick brown fox"`)
+	apiTest(t, h, "DELETE", pkg+"/entries", "", "",
+		http.StatusMethodNotAllowed, `"code":"usage"`)
+	apiTest(t, h, "GET", pkg, "", "", http.StatusOK,
+		`"package":"examples/simple"`)
+	apiTest(t, h, "POST", pkg+"/go", "", `{}`, http.StatusBadRequest,
+		`go: missing command`)
+	apiTest(t, h, "GET", "packages/examples/wont_find/entries", "", "",
+		http.StatusNotFound, `"code":"not-found"`)
+	apiTest(t, h, "GET", "nosuch", "", "", http.StatusNotFound,
+		`"code":"not-found"`)
+}
+
+func TestAPIEvents(t *testing.T) {
+	h := newTestHandler(t, new(WebServer))
+	const pkg = "packages/examples/simple"
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	defer h.Close()
+	resp, err := http.Get(srv.URL + "/goconfig/api/v1/" + pkg + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type: %s", ct)
+	}
+	rd := bufio.NewReader(resp.Body)
+	event := func() string {
+		var lines []string
+		for {
+			s, err := rd.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, s)
+		}
+	}
+	if s := event(); s != "id: 0\nevent: version\ndata: {\"version\":0}\n" {
+		t.Errorf("first event: %q", s)
+	}
+	apiTest(t, h, "PUT", pkg+"/entries/t1", "", `{"value":true}`,
+		http.StatusOK, `"value":true`)
+	if s := event(); !strings.HasPrefix(s, "id: 1\nevent: change\n") ||
+		!strings.Contains(s, `"dirty":true,"entries":[{"name":"t1"`) {
+		t.Errorf("change event: %q", s)
+	}
+	apiTest(t, h, "POST", pkg+"/reinit", "", `{"names":["t1"]}`,
+		http.StatusOK, `"version":2`)
+	if s := event(); !strings.HasPrefix(s, "id: 2\nevent: reinit\n") ||
+		!strings.Contains(s, `"value":false`) {
+		t.Errorf("reinit event: %q", s)
+	}
+	h.Close()
+	if s, err := rd.ReadString('\n'); err == nil {
+		t.Errorf("event after Close: %q", s)
+	}
+}
+
+func TestWebHandler(t *testing.T) {
+	h := newTestHandler(t, &WebServer{Prefix: "config"})
+	r := httptest.NewRequest("GET", "/config/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if loc := w.Header().Get("Location"); loc != "/config/all" {
+		t.Errorf("redirect: %d %s", w.Code, loc)
+	}
+	r = httptest.NewRequest("GET", "/config/examples/simple", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK ||
+		!strings.Contains(w.Body.String(),
+			`EventSource("/config/api/v1/packages/examples/simple/events")`) {
+		t.Errorf("page: %d\n%s", w.Code, w.Body)
+	}
+	r = httptest.NewRequest("GET", "/goconfig/examples/simple", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unprefixed page: %d", w.Code)
+	}
+}
+
+// TestWebPlatform posts the view's form with text left in the platform field.
+func TestWebPlatform(t *testing.T) {
+	h := newTestHandler(t, new(WebServer))
+	post := func(v url.Values) int {
+		v.Set("csrf", h.auth.csrf)
+		r := httptest.NewRequest("POST", "/goconfig/examples/simple",
+			strings.NewReader(v.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := post(url.Values{"change": {"t1"}}); code != http.StatusOK {
+		t.Fatalf("change: %d", code)
+	}
+	wsg := h.wsgMap["examples/simple"]
+	platform := wsg.G.Platform
+	if code := post(url.Values{"platform": {"windows/386"},
+		"switch": {"platform"}}); code != http.StatusConflict {
+		t.Errorf("unsaved switch: %d", code)
+	}
+	if wsg.G.Platform != platform || !wsg.G.Entry["t1"].Value.IsTrue() {
+		t.Errorf("unsaved switch to %v; t1: %v", wsg.G.Platform,
+			wsg.G.Entry["t1"].Value)
+	}
+	if code := post(url.Values{"platform": {"windows/386"},
+		"undo": {"undo"}}); code != http.StatusOK {
+		t.Errorf("undo: %d", code)
+	}
+	if wsg.G.Platform != platform || wsg.G.Entry["t1"].Value.IsTrue() {
+		t.Errorf("undo switched to %v; t1: %v", wsg.G.Platform,
+			wsg.G.Entry["t1"].Value)
+	}
+	if code := post(url.Values{"platform": {"windows"},
+		"switch": {"platform"}}); code != http.StatusBadRequest {
+		t.Errorf("invalid platform: %d", code)
+	}
+	if code := post(url.Values{"platform": {"windows/386"},
+		"switch": {"platform"}}); code != http.StatusOK {
+		t.Errorf("switch: %d", code)
+	}
+	if s := wsg.G.Platform.String(); s != "windows/386" {
+		t.Errorf("platform: %s", s)
+	}
+}
+
+// TestWebEscape runs a go command whose error quotes the markup given.
+func TestWebEscape(t *testing.T) {
+	h := newTestHandler(t, &WebServer{GoCommands: []string{"vet"}})
+	v := url.Values{"csrf": {h.auth.csrf}, "go": {"vet <b>x</b>"}}
+	r := httptest.NewRequest("POST", "/goconfig/examples/simple",
+		strings.NewReader(v.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if body := w.Body.String(); strings.Contains(body, "<b>") ||
+		!strings.Contains(body, "&lt;b&gt;") {
+		t.Errorf("unescaped output: %d\n%s", w.Code, body)
+	}
+}
+
+func TestAPIAccess(t *testing.T) {
+	f, err := ioutil.TempFile("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	// htpasswd -bns alice secret
+	f.WriteString("alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	f.Close()
+	h := newTestHandler(t, &WebServer{
+		Token:      "xyzzy",
+		Htpasswd:   f.Name(),
+		ReadOnly:   true,
+		GoCommands: []string{"vet"},
+	})
+	path := h.api + "packages/examples/simple"
+	for _, x := range []struct {
+		user, password, bearer string
+		status                 int
+	}{
+		{"", "", "", http.StatusUnauthorized},
+		{"", "", "plugh", http.StatusUnauthorized},
+		{"", "", "xyzzy", http.StatusOK},
+		{"bob", "xyzzy", "", http.StatusOK},
+		{"alice", "secret", "", http.StatusOK},
+		{"alice", "plugh", "", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", path, nil)
+		if x.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+x.bearer)
+		} else if x.user != "" {
+			r.SetBasicAuth(x.user, x.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != x.status {
+			t.Errorf("%+v: status %d", x, w.Code)
+		}
+	}
+	// neither MD5, the default of htpasswd, nor bcrypt is supported
+	for _, s := range []string{
+		"dave:$apr1$6yGDUuX5$YRU6hsmm6wfD9.XkxRmDv1\n",
+		"carol:$2y$05$xwJvcFR0oD53u8w2IooGr.geTVm8fKn6QtXloah4EkfgpV8yZ0I4W\n",
+	} {
+		f, err = ioutil.TempFile("", "htpasswd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.WriteString(s)
+		f.Close()
+		_, err = NewWebHandler(&WebServer{Htpasswd: f.Name()})
+		if err == nil || !strings.Contains(err.Error(), "htpasswd -s") {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	do := func(method, resource, contentType, body string,
+		status int, want string) {
+		r := httptest.NewRequest(method, path+resource,
+			strings.NewReader(body))
+		r.SetBasicAuth("alice", "secret")
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Errorf("%s %s: status %d, want %d", method, resource,
+				w.Code, status)
+		} else if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s %s: got %s, want %s", method, resource,
+				w.Body, want)
+		}
+	}
+	do("PUT", "/entries/t1", "text/plain", `{"value":true}`,
+		http.StatusUnsupportedMediaType, `"code":"usage"`)
+	do("PUT", "/entries/t1", "application/json", `{"value":true}`,
+		http.StatusForbidden, `"code":"forbidden"`)
+	do("POST", "/go", "application/json", `{"args":["run","."]}`,
+		http.StatusForbidden, `go run isn't allowed; only: vet`)
+	do("POST", "/go", "application/json",
+		`{"args":["vet","-vettool=/bin/sh","."]}`,
+		http.StatusForbidden, `go vet -vettool isn't allowed; only: -a, `)
+	do("POST", "/go", "application/json",
+		`{"args":["vet",".","--toolexec","/bin/sh"]}`,
+		http.StatusForbidden, `go vet -toolexec isn't allowed`)
+}
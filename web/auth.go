@@ -0,0 +1,181 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// wsAuthT has the access controls of the webserver.
+type wsAuthT struct {
+	*WebServer
+	users map[string]string // {SHA} passwords of htpasswd users
+	csrf  string
+}
+
+// newAuth loads the htpasswd file, if any, and makes the CSRF token of the
+// server's forms.
+func newAuth(ws *WebServer) (*wsAuthT, error) {
+	auth := &wsAuthT{WebServer: ws}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	auth.csrf = hex.EncodeToString(b)
+	if ws.Htpasswd == "" {
+		return auth, nil
+	}
+	f, err := os.Open(ws.Htpasswd)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	auth.users = make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 1 || !strings.HasPrefix(line[i+1:], "{SHA}") {
+			return nil, config.NewError(config.ErrSyntax,
+				"%s:%d: not user:{SHA}password; make it with htpasswd -s",
+				ws.Htpasswd, n)
+		}
+		auth.users[line[:i]] = line[i+1:]
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// authorize returns an unauthorized error unless the request has the bearer
+// token, or is from a browser logged in with the token or as a user of the
+// htpasswd file.
+func (auth *wsAuthT) authorize(r *http.Request) error {
+	if auth.Token == "" && auth.users == nil {
+		return nil
+	}
+	s := r.Header.Get("Authorization")
+	if strings.HasPrefix(s, "Bearer ") && auth.Token != "" &&
+		secureEqual(strings.TrimPrefix(s, "Bearer "), auth.Token) {
+		return nil
+	}
+	if user, password, ok := r.BasicAuth(); ok {
+		if auth.Token != "" && secureEqual(password, auth.Token) {
+			return nil
+		}
+		if hash, found := auth.users[user]; found &&
+			htpasswdEqual(hash, password) {
+			return nil
+		}
+	}
+	return config.NewError(config.ErrUnauthorized, "unauthorized")
+}
+
+// htpasswdEqual returns true if the password matches the {SHA} hash of
+// htpasswd -s; the bcrypt, MD5 and crypt hashes of htpasswd need packages
+// beyond the standard library so these aren't supported.
+func htpasswdEqual(hash, password string) bool {
+	sum := sha1.Sum([]byte(password))
+	return secureEqual(hash,
+		"{SHA}"+base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// handler returns that which calls h with authorized requests; the errors
+// of the api are JSON.
+func (auth *wsAuthT) handler(h http.HandlerFunc, api bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.authorize(r); err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="goconfig"`)
+			if api {
+				(&apiT{w: w, r: r}).fail(http.StatusUnauthorized, err)
+			} else {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			}
+			return
+		}
+		h(w, r)
+	}
+}
+
+// forged returns true unless the form has the CSRF token of the server.
+func (auth *wsAuthT) forged(r *http.Request) bool {
+	return !secureEqual(r.PostFormValue("csrf"), auth.csrf)
+}
+
+// forgedAPI returns true unless the request is JSON, which, unlike forms,
+// other sites can't post without the permission of CORS.
+func (auth *wsAuthT) forgedAPI(r *http.Request) bool {
+	t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err != nil || t != "application/json"
+}
+
+// goAllowed returns a forbidden error unless the go command is among those
+// allowed and its flags are only the boolean go build and test flags; others,
+// such as -exec, -toolexec, -vettool or -ldflags=-extld=..., may run any
+// program or write any file.
+func (auth *wsAuthT) goAllowed(args []string) error {
+	if len(args) > 0 {
+		allowed := false
+		for _, s := range auth.GoCommands {
+			if args[0] == s {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return config.NewError(config.ErrForbidden,
+				"go %s isn't allowed; only: %s", args[0],
+				strings.Join(auth.GoCommands, ", "))
+		}
+		for _, s := range args[1:] {
+			if !strings.HasPrefix(s, "-") {
+				continue
+			}
+			name := strings.TrimLeft(s, "-")
+			if i := strings.Index(name, "="); i >= 0 {
+				name = name[:i]
+			}
+			if !config.GoBuildFlags[name] &&
+				!config.GoTestFlags[name] {
+				return config.NewError(config.ErrForbidden,
+					"go %s -%s isn't allowed; only: %s",
+					args[0], name, goAllowedFlags())
+			}
+		}
+	}
+	return nil
+}
+
+// goAllowedFlags returns the sorted boolean go build and test flags.
+func goAllowedFlags() string {
+	var a []string
+	for k := range config.GoBuildFlags {
+		a = append(a, "-"+k)
+	}
+	for k := range config.GoTestFlags {
+		a = append(a, "-"+k)
+	}
+	sort.Strings(a)
+	return strings.Join(a, ", ")
+}
+
+// secureEqual compares the strings in constant time.
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
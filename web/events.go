@@ -0,0 +1,181 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// wsEventT is the data of a server-sent event about a package.  The change
+// and reinit events have the entries that changed; save has the configuration
+// file; and platform, after which clients should reload the package, has
+// neither.
+type wsEventT struct {
+	Version       int          `json:"version"`
+	Dirty         bool         `json:"dirty"`
+	Entries       []*apiEntryT `json:"entries,omitempty"`
+	Configuration string       `json:"configuration,omitempty"`
+}
+
+// wsEventBuffer is the number of events queued for each client; slower
+// clients are dropped, then reconnect.
+const wsEventBuffer = 16
+
+// wsKeepAlive is the interval of comments that keep idle streams open.
+const wsKeepAlive = 30 * time.Second
+
+func newWSG(g *config.GoConfig) *wsgT {
+	return &wsgT{
+		G:        g,
+		mutex:    new(sync.Mutex),
+		versions: make(map[string]int),
+		clients:  make(map[chan []byte]bool),
+	}
+}
+
+// update runs f, which may change entries directly or through set and reset
+// rules; if it did, this advances the version, marks the entries that
+// changed, and publishes them as the named event.
+func (wsg *wsgT) update(event string, f func()) {
+	before := make(map[string]string, len(wsg.G.Entries))
+	for _, e := range wsg.G.Entries {
+		before[e.Name] = e.Value.YAML()
+	}
+	f()
+	var changed []*apiEntryT
+	for _, e := range wsg.G.Entries {
+		if s, ok := before[e.Name]; !ok || s != e.Value.YAML() {
+			changed = append(changed, newAPIEntry(e))
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	wsg.Version += 1
+	for _, x := range changed {
+		wsg.versions[x.Name] = wsg.Version
+	}
+	wsg.publish(event, &wsEventT{
+		Version: wsg.Version,
+		Dirty:   wsg.G.Dirty(),
+		Entries: changed,
+	})
+}
+
+// reload advances the version after replacing all entries, as by a change of
+// platform, so that any earlier form or If-Match conflicts.
+func (wsg *wsgT) reload() {
+	wsg.Version += 1
+	for _, e := range wsg.G.Entries {
+		wsg.versions[e.Name] = wsg.Version
+	}
+	wsg.publish("platform", &wsEventT{
+		Version: wsg.Version,
+		Dirty:   wsg.G.Dirty(),
+	})
+}
+
+// saved publishes the save of the configuration.
+func (wsg *wsgT) saved() {
+	wsg.publish("save", &wsEventT{
+		Version:       wsg.Version,
+		Dirty:         wsg.G.Dirty(),
+		Configuration: wsg.G.GoConfiguration,
+	})
+}
+
+// changedSince returns true if any of the named entries, or if none, any
+// entry changed after the given version.
+func (wsg *wsgT) changedSince(version int, names ...string) bool {
+	if len(names) == 0 {
+		return version != wsg.Version
+	}
+	for _, name := range names {
+		if wsg.versions[name] > version {
+			return true
+		}
+	}
+	return false
+}
+
+// publish queues the event for each subscribed client; the caller has the
+// mutex.
+func (wsg *wsgT) publish(event string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	msg := []byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n",
+		wsg.Version, event, b))
+	for c := range wsg.clients {
+		select {
+		case c <- msg:
+		default:
+			delete(wsg.clients, c)
+			close(c)
+		}
+	}
+}
+
+func (wsg *wsgT) subscribe() chan []byte {
+	c := make(chan []byte, wsEventBuffer)
+	wsg.mutex.Lock()
+	wsg.clients[c] = true
+	wsg.mutex.Unlock()
+	return c
+}
+
+func (wsg *wsgT) unsubscribe(c chan []byte) {
+	wsg.mutex.Lock()
+	if wsg.clients[c] {
+		delete(wsg.clients, c)
+		close(c)
+	}
+	wsg.mutex.Unlock()
+}
+
+// events streams the server-sent events of the package until the client
+// disconnects; the first is a version event.
+func (api *apiT) events() {
+	f, ok := api.w.(http.Flusher)
+	if !ok {
+		api.fail(http.StatusInternalServerError, config.NewError(
+			config.ErrInternal, "streaming isn't supported"))
+		return
+	}
+	c := api.wsg.subscribe()
+	defer api.wsg.unsubscribe(c)
+	api.wsg.mutex.Lock()
+	version := api.wsg.Version
+	api.wsg.mutex.Unlock()
+	h := api.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	api.w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(api.w, "id: %d\nevent: version\ndata: {\"version\":%d}\n\n",
+		version, version)
+	f.Flush()
+	tick := time.NewTicker(wsKeepAlive)
+	defer tick.Stop()
+	for {
+		select {
+		case msg, ok := <-c:
+			if !ok {
+				return
+			}
+			api.w.Write(msg)
+		case <-tick.C:
+			fmt.Fprint(api.w, ": keep-alive\n\n")
+		case <-api.r.Context().Done():
+			return
+		}
+		f.Flush()
+	}
+}
@@ -0,0 +1,758 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package web serves the goconfig pages and REST API of packages with a
+// WebHandler that may be mounted in other servers, or with ListenAndServe.
+package web
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/tgrennan/goconfig.v0/config"
+	"gopkg.in/tgrennan/quotation.v0"
+	html "html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebServer is the argument of ListenAndServe and NewWebHandler.
+// Without a Token or Htpasswd file of users and {SHA} passwords,
+// anyone that may connect to the Address may change the configuration unless
+// ReadOnly.  Browsers may only run the listed GoCommands (e.g. build, vet)
+// with boolean go build and test flags.  The pages are at the path Prefix,
+// /goconfig/ by default; with a TLSCert and TLSKey file, the server is HTTPS.
+type WebServer struct {
+	Address    string
+	Prefix     string
+	Token      string
+	Htpasswd   string
+	ReadOnly   bool
+	GoCommands []string
+	TLSCert    string
+	TLSKey     string
+}
+
+type wsgT struct { // WebServer GoConfig
+	G        *config.GoConfig
+	mutex    *sync.Mutex
+	Version  int
+	versions map[string]int // of each entry's last change
+	clients  map[chan []byte]bool
+}
+
+type wshT struct { // WebServer Handler
+	Name    string
+	String  string
+	command string
+	path    string
+	tmpl    string
+	Heading html.HTML
+	Body    html.HTML
+	Index   int
+	status  int
+	err     error
+	WSG     *wsgT
+	wh      *WebHandler
+}
+
+// WebHandler serves the pages, and below them the REST API, of the
+// webserver at its path prefix; for example,
+//
+//	h, err := NewWebHandler(&WebServer{Prefix: "/dashboard/goconfig/"})
+//	...
+//	http.Handle("/dashboard/goconfig/", h)
+//
+// The handler has its own packages; Close ends their event streams for the
+// shutdown of its server.
+type WebHandler struct {
+	auth     *wsAuthT
+	prefix   string
+	api      string
+	tmpl     *html.Template
+	mux      *http.ServeMux
+	wsgMutex sync.Mutex
+	wsgMap   map[string]*wsgT
+}
+
+// wsPrefix is the default path prefix of the webserver.
+const wsPrefix = "/goconfig/"
+
+// wsShutdown is the time that the server waits for requests to finish after
+// an interrupt.
+const wsShutdown = 5 * time.Second
+const wsSource = `
+{{define "__top__"}}
+{{$black := "#000000"}}
+{{$softwhite := "#D0D0D0"}}
+{{$brightred := "#E00000"}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="cache-control" content="no-cache">
+<meta name="robots" content="none">
+<title>goconfig: {{.Package}} {{.Platform}}{{if .Dirty}} (unsaved){{end}}</title>
+<style>
+a.goconfig {
+	background-color: {{$black}};
+	color: {{$softwhite}};
+	text-decoration: none;
+}
+body {
+	background-color: {{$black}};
+	color: {{$softwhite}};
+	font-family: Arial,sans-serif;
+	font-size: 100%;
+}
+button {
+	background-color: {{$black}};
+	color: {{$softwhite}};
+	border-size: 2px;
+	border-radius: 7px;
+	font-family: Arial,sans-serif;
+	font-size: 90%;
+}
+button.entry {
+	background-color: {{$black}};
+	color: {{$softwhite}};
+	border: none;
+	font-family: Monaco,monospace;
+	font-size: 90%;
+	padding: 0 0 0 0;
+}
+code, tt {
+	font-family: Monaco,monospace;
+	font-size: 90%;
+}
+error {
+	background-color: {{$black}};
+	color: {{$brightred}};
+	font-family: Arial,sans-serif;
+	font-size: 110%;
+}
+h1 {
+	font-size: 110%;
+	font-weight: bold;
+	font-family: Monaco,monospace;
+}
+input.button {
+	background-color: {{$black}};
+	color: {{$softwhite}};
+	border-size: 2px;
+	border-radius: 7px;
+	font-family: Arial,sans-serif;
+	font-size: 90%;
+}
+input.text {
+	background-color: {{$black}};
+	color: {{$softwhite}};
+	border-size: 2px;
+	border-radius: 7px;
+	font-family: Monaco,monospace;
+	font-size: 90%;
+}
+</style>
+</head>
+<body>
+<h1>goconfig: {{.Package}} {{.Platform}}</h1>
+{{end}}
+
+{{define "__bottom__"}}
+</body>
+</html>
+{{end}}
+
+{{define "change"}}
+{{template "__top__" .WSG.G}}
+<form	method="POST">
+<input	type="hidden"
+	name="csrf"
+	value="{{.CSRF}}">
+<input	type="hidden"
+	name="version"
+	value="{{.WSG.Version}}">
+<code>{{.Name}}</code>:
+<input
+	class="text"
+	name="s"
+	type="text"
+	size="55"
+	value="{{.String}}"
+	autofocus><br>
+<button	type="submit"
+	name="set"
+	value="{{.Name}}"
+>set</button>
+<button	type="submit"
+	name="reinitialize"
+	value="{{.Name}}"
+>reinitialize</button>
+<button	type="submit"
+	name="cancel"
+	value="set"
+>cancel</button>
+</form>
+{{template "__bottom__"}}
+{{end}}
+
+{{define "conflict"}}
+{{template "__top__" .WSG.G}}
+<p><b>Warning!</b></p>
+<form	method="POST">
+<input	type="hidden"
+	name="csrf"
+	value="{{.CSRF}}">
+<p>The configuration was changed by another session;<br>
+<button	type="submit"
+	name="cancel"
+	value="results"
+	autofocus
+>resume</button> to review then resubmit.</p>
+</form>
+{{template "__bottom__"}}
+{{end}}
+
+{{define "go"}}
+{{template "__top__" .WSG.G}}
+<form	method="POST">
+<input	type="hidden"
+	name="csrf"
+	value="{{.CSRF}}">
+<input	type="hidden"
+	name="version"
+	value="{{.WSG.Version}}">
+go command:
+<input	class="text"
+	name="s"
+	type="text"
+	size="55"
+	autofocus
+><br>
+<button
+	type="submit"
+	name="run"
+	value="Go"
+>go</button>
+<button	type="submit"
+	name="cancel"
+	value="go"
+>cancel</button>
+</form>
+{{template "__bottom__"}}
+{{end}}
+
+{{define "list"}}
+{{template "__top__" .WSG.G}}
+<p>Select one of these packages:</p>
+<p>
+{{range $E := .WSG.G.Entries}}
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code><a
+	class="goconfig"
+	href="{{$.Prefix}}{{$E.Name}}"
+>{{$E.Name}}</a><br>
+{{end}}</p>
+{{template "__bottom__"}}
+{{end}}
+
+{{define "results"}}
+{{template "__top__" .WSG.G}}
+{{with .Heading}}{{.}}{{end}}
+{{with .Body}}{{.}}{{end}}
+<form	method="POST">
+<input	type="hidden"
+	name="csrf"
+	value="{{.CSRF}}">
+<button	type="submit"
+	name="cancel"
+	value="results"
+	autofocus
+>resume</button>
+</form>
+{{template "__bottom__"}}
+{{end}}
+
+{{define "view"}}
+{{template "__top__" .WSG.G}}
+{{$WS := .}}
+<p>
+<form	method="POST">
+<input	type="hidden"
+	name="csrf"
+	value="{{.CSRF}}">
+<input	type="hidden"
+	id="version"
+	name="version"
+	value="{{.WSG.Version}}">
+{{range $E := .WSG.G.Entries}}
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code>
+<button	class="entry"
+	type="submit"
+	name="info"
+	value="{{$E.Name}}"
+>{{$E.Name}}</button>:
+<button	class="entry"
+	type="submit"
+	id="value.{{$E.Name}}"
+	name="change"
+	value="{{$E.Name}}"
+>{{with $E.Value.String}}{{.}}{{else}}nil{{end}}</button><br>
+{{end}}
+</p>
+<p>
+go command:
+<input	class="text"
+	name="go"
+	type="text"
+	size="55"
+	autofocus
+></p>
+<p>
+Select...<br>
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code>
+an entry name for info;<br>
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code>
+a value to change it;<br>
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code>
+<button	type="submit"
+	name="gotool"
+	value="go"
+>go</button>
+to execute the given build, test, run, or install command;<br>
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code>
+<input	class="text"
+	name="platform"
+	type="text"
+	size="15"
+	placeholder="{{.WSG.G.Platform}}"
+>
+<button	type="submit"
+	name="switch"
+	value="platform"
+>platform</button>
+to reload for another GOOS/GOARCH;<br>
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code>
+<button	type="submit"
+	name="undo"
+	value="undo"
+>undo</button>
+or
+<button	type="submit"
+	name="redo"
+	value="redo"
+>redo</button>
+the last change;<br>
+<code>&nbsp;&nbsp;&nbsp;&nbsp;</code>
+<button	type="submit"
+	name="reinitialize"
+	value="all"
+>reinitialize</button>
+or
+<button	type="submit"
+	name="save"
+	value="save"
+>save</button>
+this package configuration.
+</p>
+</form>
+<script>
+var events = new EventSource({{.Events}});
+function update(ev) {
+	var x = JSON.parse(ev.data);
+	document.getElementById("version").value = x.version;
+	(x.entries || []).forEach(function(e) {
+		var b = document.getElementById("value." + e.name);
+		if (b) {
+			b.textContent = e.value === null || e.value === "" ?
+				"nil" : String(e.value);
+		}
+	});
+	document.title = document.title.replace(/ \(unsaved\)$/, "") +
+		(x.dirty ? " (unsaved)" : "");
+}
+events.addEventListener("change", update);
+events.addEventListener("reinit", update);
+events.addEventListener("save", update);
+events.addEventListener("platform", function() { location.reload(); });
+</script>
+{{template "__bottom__"}}
+{{end}}
+`
+
+// ListenAndServe serves the WebHandler of ws at its prefix, and redirects
+// others to its package list, until interrupted.
+func ListenAndServe(ws *WebServer) (err error) {
+	if (ws.TLSCert == "") != (ws.TLSKey == "") {
+		return config.NewError(config.ErrUsage,
+			"-tls-cert and -tls-key go together")
+	}
+	h, err := NewWebHandler(ws)
+	if err != nil {
+		return
+	}
+	defer h.Close()
+	if _, err = h.wsgFor(config.ALL); err != nil {
+		return
+	}
+	host, _, _ := net.SplitHostPort(ws.Address)
+	ip := net.ParseIP(host)
+	if ws.Token == "" && ws.Htpasswd == "" && host != "localhost" &&
+		(ip == nil || !ip.IsLoopback()) {
+		log.Print("warning: anyone that may connect to ", ws.Address,
+			" may change configuration; see -token and -htpasswd")
+	}
+	mux := http.NewServeMux()
+	mux.Handle(h.prefix, h)
+	mux.Handle("/", http.RedirectHandler(h.prefix+config.ALL,
+		http.StatusFound))
+	srv := &http.Server{Addr: ws.Address, Handler: mux}
+	srv.RegisterOnShutdown(h.Close)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	stopped := make(chan error, 1)
+	go func() {
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(),
+			wsShutdown)
+		defer cancel()
+		stopped <- srv.Shutdown(ctx)
+	}()
+	if ws.TLSCert != "" {
+		err = srv.ListenAndServeTLS(ws.TLSCert, ws.TLSKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		err = <-stopped
+	}
+	return
+}
+
+// NewWebHandler returns the handler of the webserver's pages at the prefix
+// of ws, "/goconfig/" by default, and its REST API at prefix + "api/v1/".
+// The handler expects the full path of requests, so it mustn't be wrapped
+// by http.StripPrefix.
+func NewWebHandler(ws *WebServer) (*WebHandler, error) {
+	h := &WebHandler{
+		prefix: ws.Prefix,
+		mux:    http.NewServeMux(),
+		wsgMap: make(map[string]*wsgT),
+	}
+	if h.prefix == "" {
+		h.prefix = wsPrefix
+	}
+	if !strings.HasPrefix(h.prefix, "/") {
+		h.prefix = "/" + h.prefix
+	}
+	if !strings.HasSuffix(h.prefix, "/") {
+		h.prefix += "/"
+	}
+	h.api = h.prefix + apiPath
+	var err error
+	if h.tmpl, err = html.New("ws").Parse(wsSource); err != nil {
+		return nil, err
+	}
+	if h.auth, err = newAuth(ws); err != nil {
+		return nil, err
+	}
+	h.mux.HandleFunc(h.prefix, h.auth.handler(h.page, false))
+	h.mux.HandleFunc(h.api, h.auth.handler(h.apiHandler, true))
+	return h, nil
+}
+
+func (h *WebHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Close ends the event streams of the handler's packages.
+func (h *WebHandler) Close() {
+	h.wsgMutex.Lock()
+	defer h.wsgMutex.Unlock()
+	for _, wsg := range h.wsgMap {
+		wsg.mutex.Lock()
+		for c := range wsg.clients {
+			delete(wsg.clients, c)
+			close(c)
+		}
+		wsg.mutex.Unlock()
+	}
+}
+
+// wsgFor returns the webserver GoConfig of the package, loading its
+// declarations and configuration on first use.
+func (h *WebHandler) wsgFor(pkg string) (*wsgT, error) {
+	h.wsgMutex.Lock()
+	defer h.wsgMutex.Unlock()
+	if x, ok := h.wsgMap[pkg]; ok {
+		return x, nil
+	}
+	g, err := config.NewGoConfig(pkg)
+	if err != nil {
+		return nil, err
+	}
+	if !g.IsList() {
+		if err = g.Load(nil); err != nil {
+			return nil, err
+		}
+	}
+	x := newWSG(g)
+	h.wsgMap[pkg] = x
+	return x, nil
+}
+
+// page handles the form of the package page at the path after the prefix.
+func (h *WebHandler) page(w http.ResponseWriter, r *http.Request) {
+	wsh := &wshT{wh: h}
+	defer func() {
+		if wsh.tmpl != "" {
+			wsh.err = h.tmpl.ExecuteTemplate(w, wsh.tmpl, wsh)
+		}
+		if wsh.WSG != nil && wsh.WSG.mutex != nil {
+			wsh.WSG.mutex.Unlock()
+		}
+		if wsh.err != nil {
+			if wsh.status < http.StatusBadRequest {
+				wsh.status = http.StatusInternalServerError
+			}
+			http.Error(w, wsh.err.Error(), wsh.status)
+		} else if wsh.status == http.StatusNotFound {
+			http.NotFound(w, r)
+		} else if wsh.status >= http.StatusMultipleChoices {
+			http.Redirect(w, r, h.prefix+wsh.path, wsh.status)
+		}
+	}()
+	if wsh.path = strings.TrimPrefix(r.URL.Path, h.prefix); wsh.path == "" {
+		wsh.path, wsh.status = config.ALL, http.StatusFound
+		return
+	}
+	if wsh.WSG, wsh.err = h.wsgFor(wsh.path); wsh.err != nil {
+		wsh.status = http.StatusUnauthorized
+		return
+	}
+	wsh.WSG.mutex.Lock()
+	if r.Method == "POST" && h.auth.forged(r) {
+		wsh.status = http.StatusForbidden
+		wsh.err = errors.New("invalid or missing CSRF token")
+		return
+	}
+	for _, x := range []struct {
+		c     string
+		f     func(string, *http.Request)
+		write bool
+	}{
+		{"cancel", wsh.cancel, false},
+		{"change", wsh.change, true},
+		{"go", wsh.gotool, false},
+		{"switch", wsh.platform, true},
+		{"info", wsh.info, false},
+		{"redo", wsh.redo, true},
+		{"reinitialize", wsh.reinitialize, true},
+		{"save", wsh.save, true},
+		{"set", wsh.set, true},
+		{"undo", wsh.undo, true},
+	} {
+		if s := r.PostFormValue(x.c); s != "" {
+			if x.write && h.auth.ReadOnly {
+				wsh.status = http.StatusForbidden
+				wsh.err = errors.New("read-only")
+			} else if wsh.command = x.c; !wsh.conflict(s, r) {
+				x.f(s, r)
+			}
+			return
+		}
+	}
+	if wsh.path == config.ALL {
+		wsh.status, wsh.tmpl = http.StatusOK, "list"
+	} else {
+		wsh.status, wsh.tmpl = http.StatusOK, "view"
+	}
+	return
+}
+
+// entry selects the named entry or, from forms of earlier versions, the
+// entry at the index.
+func (wsh *wshT) entry(s string) {
+	for i, e := range wsh.WSG.G.Entries {
+		if e.Name == s {
+			wsh.Index, wsh.Name = i, s
+			return
+		}
+	}
+	if wsh.Index, wsh.err = strconv.Atoi(s); wsh.err != nil {
+		wsh.status = http.StatusBadRequest
+	} else if wsh.Index < 0 || wsh.Index >= len(wsh.WSG.G.Entries) {
+		wsh.status = http.StatusRequestedRangeNotSatisfiable
+		wsh.err = errors.New("index exceeds entries")
+	} else {
+		wsh.Name = wsh.WSG.G.Entries[wsh.Index].Name
+	}
+}
+
+// CSRF returns the token of the server's forms.
+func (wsh *wshT) CSRF() string {
+	return wsh.wh.auth.csrf
+}
+
+// Events returns the path of the package's server-sent events.
+func (wsh *wshT) Events() string {
+	return wsh.wh.api + "packages/" + wsh.path + "/events"
+}
+
+// Prefix returns the path of the package pages.
+func (wsh *wshT) Prefix() string {
+	return wsh.wh.prefix
+}
+
+func (wsh *wshT) cancel(_ string, _ *http.Request) {
+	wsh.status = http.StatusSeeOther
+}
+
+func (wsh *wshT) change(s string, _ *http.Request) {
+	if wsh.entry(s); wsh.err == nil {
+		wsh.status = http.StatusNotFound
+		if entry := wsh.WSG.G.Entry[wsh.Name]; entry != nil {
+			if value := entry.Value; value != nil {
+				wsh.status = http.StatusOK
+				if value.IsTag() {
+					s := strconv.FormatBool(!value.IsTrue())
+					wsh.WSG.update("change", func() {
+						wsh.WSG.G.Set(config.OriginUser,
+							wsh.Name, s)
+					})
+					wsh.tmpl = "view"
+				} else {
+					wsh.String = value.String()
+					wsh.tmpl = "change"
+				}
+			}
+		}
+	}
+}
+
+// conflict returns true if another session changed what the command would
+// since the version of the form; that is, the entry to change, set or
+// reinitialize, or any entry for those of the whole package.  Other commands
+// don't conflict.
+func (wsh *wshT) conflict(s string, r *http.Request) bool {
+	version, err := strconv.Atoi(r.PostFormValue("version"))
+	if err != nil {
+		return false
+	}
+	var names []string
+	switch wsh.command {
+	case "change", "set", "reinitialize":
+		if wsh.command == "reinitialize" && s == "all" {
+			break
+		}
+		if wsh.entry(s); wsh.err != nil {
+			return false
+		}
+		names = []string{wsh.Name}
+	case "switch", "redo", "undo":
+	default:
+		return false
+	}
+	if wsh.WSG.changedSince(version, names...) {
+		wsh.tmpl = "conflict"
+		return true
+	}
+	return false
+}
+
+func (wsh *wshT) gotool(s string, _ *http.Request) {
+	wsh.tmpl = "results"
+	if err := wsh.wh.auth.goAllowed(quotation.Fields(s)); err != nil {
+		wsh.Heading = `<error>Error:</error>`
+		wsh.Body = html.HTML(`<pre>` + html.HTMLEscapeString(err.Error()) +
+			`</pre>`)
+	} else if b, err := wsh.WSG.G.Exec("go " + s); err != nil {
+		wsh.Heading = `<error>Error:</error>`
+		wsh.Body = html.HTML(`<pre>` + html.HTMLEscapeString(err.Error()) +
+			"\n" + html.HTMLEscapeString(string(b)) + `</pre>`)
+	} else {
+		wsh.Heading = `<p>Results:</p>`
+		wsh.Body = html.HTML(`<pre>` + html.HTMLEscapeString(string(b)) +
+			`</pre>`)
+	}
+}
+
+func (wsh *wshT) info(s string, _ *http.Request) {
+	if wsh.entry(s); wsh.err == nil {
+		wsh.Body = html.HTML(`<pre>` +
+			html.HTMLEscapeString(wsh.WSG.G.Marshal(wsh.Name)) +
+			"\n" + html.HTMLEscapeString(wsh.WSG.G.Explain(wsh.Name)) +
+			`</pre>`)
+		wsh.status, wsh.tmpl = http.StatusOK, "results"
+	}
+}
+
+// platform switches to the GOOS/GOARCH of the form's platform field.
+func (wsh *wshT) platform(_ string, r *http.Request) {
+	s := r.PostFormValue("platform")
+	if p, err := config.ParsePlatform(strings.TrimSpace(s)); err != nil {
+		wsh.status, wsh.err = http.StatusBadRequest, err
+	} else if err = wsh.WSG.G.SetPlatform(p); err != nil {
+		wsh.status, wsh.err = http.StatusInternalServerError, err
+		if e, ok := err.(*config.Error); ok &&
+			e.Code == config.ErrConflict {
+			wsh.status = http.StatusConflict
+		}
+	} else {
+		wsh.status, wsh.tmpl = http.StatusOK, "view"
+		wsh.WSG.reload()
+	}
+}
+
+func (wsh *wshT) redo(_ string, _ *http.Request) {
+	wsh.status, wsh.tmpl = http.StatusOK, "view"
+	wsh.WSG.update("change", func() { wsh.WSG.G.Redo() })
+}
+
+func (wsh *wshT) reinitialize(s string, _ *http.Request) {
+	if s == "all" {
+		wsh.status, wsh.tmpl = http.StatusOK, "view"
+		wsh.WSG.update("reinit", wsh.WSG.G.Reinit)
+	} else if wsh.entry(s); wsh.err == nil {
+		wsh.status, wsh.tmpl = http.StatusOK, "view"
+		wsh.WSG.update("reinit", func() { wsh.WSG.G.Unset(wsh.Name) })
+	}
+}
+
+func (wsh *wshT) save(_ string, _ *http.Request) {
+	wsh.tmpl = "results"
+	if err := wsh.WSG.G.Store(); err != nil {
+		wsh.Heading = `<error>Error:</error>`
+		wsh.Body = html.HTML(`<pre>` + html.HTMLEscapeString(err.Error()) +
+			`</pre>`)
+		wsh.status = http.StatusUnauthorized
+	} else {
+		wsh.Body = html.HTML(`<p>Wrote: <code>` +
+			html.HTMLEscapeString(wsh.WSG.G.GoConfiguration) +
+			`</code></p>`)
+		wsh.status = http.StatusOK
+		wsh.WSG.saved()
+	}
+}
+
+func (wsh *wshT) set(s string, r *http.Request) {
+	wsh.tmpl = "results"
+	if wsh.entry(s); wsh.err == nil {
+		wsh.WSG.update("change", func() {
+			wsh.WSG.G.Set(config.OriginUser, wsh.Name,
+				r.PostFormValue("s"))
+		})
+		wsh.status, wsh.tmpl = http.StatusOK, "view"
+	}
+}
+
+func (wsh *wshT) undo(_ string, _ *http.Request) {
+	wsh.status, wsh.tmpl = http.StatusOK, "view"
+	wsh.WSG.update("change", func() { wsh.WSG.G.Undo() })
+}
@@ -0,0 +1,369 @@
+// Copyright 2014 Tom Grennan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !noTUI
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// input edits the text after the prompt on the status line until ENTER; this
+// returns false if canceled with ESC or ^G.  Keys that accept rejects are
+// ignored and, if validate fails, its error is shown after the text until the
+// next key.
+func (tui *tuiT) input(prompt, text string, accept func(rune) bool,
+	validate func(string) error) (string, bool) {
+	var msg string
+	buf := []rune(text)
+	pos := len(buf)
+	tui.scr.Cursor(true)
+	defer tui.scr.Cursor(false)
+	for {
+		max := tui.cols - len([]rune(prompt)) - 1
+		tui.scr.Move(tui.rows-1, 0)
+		tui.scr.ClearToEOL()
+		tui.scr.AttrOn(tui.theme.Status)
+		tui.scr.Print(prompt)
+		tui.scr.AttrOff(tui.theme.Status)
+		tui.scr.Print(string(buf))
+		if msg != "" {
+			tui.scr.Print("  ")
+			tui.scr.AttrOn(tui.theme.Entry)
+			tui.scr.Print(msg)
+			tui.scr.AttrOff(tui.theme.Entry)
+		}
+		tui.scr.Move(tui.rows-1, len([]rune(prompt))+pos)
+		r := tui.key()
+		msg = ""
+		switch r {
+		case keyResize:
+			tuiResize(tui, 0)
+		case ctrlM, ctrlJ:
+			s := string(buf)
+			if validate != nil {
+				if err := validate(s); err != nil {
+					msg = err.Error()
+					continue
+				}
+			}
+			return s, true
+		case esc, ctrlG, ctrlD:
+			return "", false
+		case keyLeft, ctrlB:
+			if pos > 0 {
+				pos -= 1
+			}
+		case keyRight, ctrlF:
+			if pos < len(buf) {
+				pos += 1
+			}
+		case keyHome, ctrlA:
+			pos = 0
+		case keyEnd, ctrlE:
+			pos = len(buf)
+		case ctrlH, del:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos -= 1
+			}
+		case keyDelete:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case ctrlK:
+			buf = buf[:pos]
+		case ctrlU:
+			buf = append(buf[:0], buf[pos:]...)
+			pos = 0
+		default:
+			if !unicode.IsPrint(r) || len(buf) >= max {
+				break
+			}
+			if accept != nil && !accept(r) {
+				msg = "invalid character: " + strconv.QuoteRune(r)
+				break
+			}
+			buf = append(buf, 0)
+			copy(buf[pos+1:], buf[pos:])
+			buf[pos] = r
+			pos += 1
+		}
+	}
+}
+
+// pick returns the choice selected from a scrollable popup list that begins
+// at the current value; this returns false if canceled with ESC, ^G or q.
+func (tui *tuiT) pick(title string, choices []string,
+	current string) (string, bool) {
+	var i, first int
+	for j, s := range choices {
+		if s == current {
+			i = j
+		}
+	}
+	for {
+		width := len([]rune(title)) + 4
+		for _, s := range choices {
+			if n := len([]rune(s)) + 4; n > width {
+				width = n
+			}
+		}
+		if width > tui.cols {
+			width = tui.cols
+		}
+		height := len(choices) + 2
+		if height > tui.rows-1 {
+			height = tui.rows - 1
+		}
+		n := height - 2
+		top, left := (tui.rows-1-height)/2, (tui.cols-width)/2
+		if i < first {
+			first = i
+		} else if i >= first+n {
+			first = i - n + 1
+		}
+		// a taller screen may show more choices than follow the first
+		if first > len(choices)-n {
+			first = len(choices) - n
+		}
+		if first < 0 {
+			first = 0
+		}
+		tui.box(top, left, height, width, title)
+		for row := 0; row < n; row++ {
+			k := first + row
+			tui.scr.Move(top+1+row, left+1)
+			if k == i {
+				tui.scr.AttrOn(tui.theme.Entry)
+			}
+			tui.scr.Print(fit(" "+choices[k], width-2, ' '))
+			tui.scr.AttrOff(tui.theme.Entry)
+		}
+		tui.status("ENTER picks; ESC cancels.")
+		switch tui.key() {
+		case ctrlM, ctrlJ:
+			return choices[i], true
+		case keyResize:
+			tuiResize(tui, 0)
+		case keyMouse:
+			// a click picks the selected choice or selects another
+			row, col := tui.scr.Mouse()
+			row -= top + 1
+			if row < 0 || row >= n || col <= left || col >= left+width-1 {
+				break
+			}
+			if first+row == i {
+				return choices[i], true
+			}
+			i = first + row
+		case keyWheelUp:
+			i -= 3
+		case keyWheelDown:
+			i += 3
+		case esc, ctrlG, ctrlD, 'q':
+			return "", false
+		case keyUp, ctrlP, shiftTab, 'k', '-':
+			i -= 1
+		case keyDown, ctrlN, '\t', 'j', '+':
+			i += 1
+		case keyPageUp, ctrlB, metaV:
+			i -= n
+		case keyPageDown, ctrlF, ctrlV:
+			i += n
+		case keyHome, metaLT:
+			i = 0
+		case keyEnd, metaGT:
+			i = len(choices) - 1
+		}
+		if i < 0 {
+			i = 0
+		} else if i >= len(choices) {
+			i = len(choices) - 1
+		}
+	}
+}
+
+// edit returns the text changed with a full screen editor until ^S or false
+// if canceled with ESC or ^G.  If validate fails, ^S shows its error on the
+// status line and resumes editing.
+func (tui *tuiT) edit(title, text string,
+	validate func(string) error) (string, bool) {
+	var y, x, top, left int
+	var msg string
+	var lines [][]rune
+	for _, s := range strings.Split(text, "\n") {
+		lines = append(lines, []rune(s))
+	}
+	tui.scr.Cursor(true)
+	defer tui.scr.Cursor(false)
+	for {
+		n := tui.rows - 2
+		if y < top {
+			top = y
+		} else if y >= top+n {
+			top = y - n + 1
+		}
+		if x < left {
+			left = x
+		} else if x >= left+tui.cols {
+			left = x - tui.cols + 1
+		}
+		tui.scr.Clear()
+		tui.scr.AttrOn(tui.theme.Status)
+		tui.scr.Print(fit(title, tui.cols, ' '))
+		tui.scr.AttrOff(tui.theme.Status)
+		for row := 0; row < n && top+row < len(lines); row++ {
+			var s string
+			if line := lines[top+row]; left < len(line) {
+				s = strings.Replace(string(line[left:]), "\t", " ",
+					-1)
+			}
+			tui.scr.Move(row+1, 0)
+			tui.scr.Print(fit(s, tui.cols, ' '))
+		}
+		if msg == "" {
+			msg = "line " + strconv.Itoa(y+1) + " of " +
+				strconv.Itoa(len(lines)) + "; ^S saves; ESC cancels."
+		}
+		tui.status(msg)
+		msg = ""
+		tui.scr.Move(y-top+1, x-left)
+		r := tui.key()
+		line := lines[y]
+		switch r {
+		case keyResize:
+			// the next loop redraws the editor in the new size
+		case keyMouse:
+			row, col := tui.scr.Mouse()
+			if row > 0 && row <= n && top+row-1 < len(lines) {
+				y, x = top+row-1, left+col
+			}
+		case keyWheelUp:
+			y -= 3
+		case keyWheelDown:
+			y += 3
+		case ctrlS:
+			s := joinLines(lines)
+			if validate != nil {
+				if err := validate(s); err != nil {
+					msg = "error: " + err.Error()
+					continue
+				}
+			}
+			return s, true
+		case esc, ctrlG, ctrlD:
+			return "", false
+		case keyUp, ctrlP:
+			y -= 1
+		case keyDown, ctrlN:
+			y += 1
+		case keyPageUp, metaV:
+			y -= n
+		case keyPageDown, ctrlV:
+			y += n
+		case keyLeft, ctrlB:
+			if x > 0 {
+				x -= 1
+			} else if y > 0 {
+				y -= 1
+				x = len(lines[y])
+			}
+		case keyRight, ctrlF:
+			if x < len(line) {
+				x += 1
+			} else if y < len(lines)-1 {
+				y, x = y+1, 0
+			}
+		case keyHome, ctrlA:
+			x = 0
+		case keyEnd, ctrlE:
+			x = len(line)
+		case metaLT:
+			y, x = 0, 0
+		case metaGT:
+			y = len(lines) - 1
+			x = len(lines[y])
+		case ctrlM, ctrlJ:
+			tail := append([]rune(nil), line[x:]...)
+			lines[y] = line[:x]
+			lines = append(lines, nil)
+			copy(lines[y+2:], lines[y+1:])
+			lines[y+1] = tail
+			y, x = y+1, 0
+		case ctrlH, del:
+			if x > 0 {
+				lines[y] = append(line[:x-1], line[x:]...)
+				x -= 1
+			} else if y > 0 {
+				x = len(lines[y-1])
+				lines[y-1] = append(lines[y-1], line...)
+				lines = append(lines[:y], lines[y+1:]...)
+				y -= 1
+			}
+		case keyDelete, ctrlK:
+			if r == ctrlK && x < len(line) {
+				lines[y] = line[:x]
+			} else if x < len(line) {
+				lines[y] = append(line[:x], line[x+1:]...)
+			} else if y < len(lines)-1 {
+				lines[y] = append(line, lines[y+1]...)
+				lines = append(lines[:y+1], lines[y+2:]...)
+			}
+		default:
+			if r == '\t' || unicode.IsPrint(r) {
+				line = append(line, 0)
+				copy(line[x+1:], line[x:])
+				line[x] = r
+				lines[y] = line
+				x += 1
+			}
+		}
+		if y < 0 {
+			y = 0
+		} else if y >= len(lines) {
+			y = len(lines) - 1
+		}
+		if x > len(lines[y]) {
+			x = len(lines[y])
+		}
+	}
+}
+
+// box draws a frame with the title in its top border.
+func (tui *tuiT) box(top, left, height, width int, title string) {
+	tui.scr.Move(top, left)
+	tui.scr.Print("┌" + fit("─ "+title+" ", width-2, '─') + "┐")
+	for row := top + 1; row < top+height-1; row++ {
+		tui.scr.Move(row, left)
+		tui.scr.Print("│" + strings.Repeat(" ", width-2) + "│")
+	}
+	tui.scr.Move(top+height-1, left)
+	tui.scr.Print("└" + strings.Repeat("─", width-2) + "┘")
+}
+
+// fit returns the text cut or padded to n characters.
+func fit(s string, n int, pad rune) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s + strings.Repeat(string(pad), n-len(r))
+}
+
+// isNumberRune returns true for the characters of Go number literals.
+func isNumberRune(r rune) bool {
+	return strings.ContainsRune("0123456789+-._abcdefABCDEFoOpPxX", r)
+}
+
+func joinLines(lines [][]rune) string {
+	a := make([]string, len(lines))
+	for i, line := range lines {
+		a[i] = string(line)
+	}
+	return strings.Join(a, "\n")
+}